@@ -1,12 +1,19 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"google.golang.org/protobuf/proto"
+	"io"
 	"jie_cache/cache"
+	"jie_cache/guard"
 	"jie_cache/pb"
+	"jie_cache/peer"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 func HTTPHandler(c *gin.Context) {
@@ -23,14 +30,171 @@ func HTTPHandler(c *gin.Context) {
 		c.String(http.StatusNotFound, "no such group: "+groupName)
 		return
 	}
-	val, err := group.Get(key)
-	if err != nil {
+	ctx, cancel := requestContext(c)
+	defer cancel()
+	var resp *pb.Response
+	val, err := group.GetContext(ctx, key)
+	if rejected := guard.Rejected(err); rejected != nil {
+		// 数据源正在受到保护, 调用方不应重试，也不应回退到自己的数据源
+		c.String(rejectedStatus(rejected), rejected.Error())
+		return
+	}
+	switch {
+	case errors.Is(err, cache.ErrNotFound):
+		// 告诉调用方 key 不存在, 调用方不再回退到自己的数据源
+		resp = notFoundResponse(group)
+	case err != nil:
 		c.String(http.StatusInternalServerError, err.Error())
 		return
+	default:
+		resp = newResponse(val)
 	}
 
 	// 编码
-	body, err := proto.Marshal(&pb.Response{Value: val.ByteSlice()})
+	body, err := proto.Marshal(resp)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "proto marshal fail")
+		return
+	}
+	c.Data(http.StatusOK, "application/octet-stream", body)
+}
+
+// rejectedStatus 返回 Guard 拒绝调用时的状态码，限流返回 429，熔断和并发数达到上限返回 503
+func rejectedStatus(rejected error) int {
+	if rejected == guard.ErrRateLimited {
+		return http.StatusTooManyRequests
+	}
+	return http.StatusServiceUnavailable
+}
+
+// requestContext 返回请求的 ctx，并使用调用方传递过来的超时时间
+func requestContext(c *gin.Context) (context.Context, context.CancelFunc) {
+	ctx := c.Request.Context()
+	if timeout, err := strconv.ParseInt(c.GetHeader(peer.TimeoutHeader), 10, 64); err == nil && timeout > 0 {
+		return context.WithTimeout(ctx, time.Duration(timeout)*time.Millisecond)
+	}
+	return context.WithCancel(ctx)
+}
+
+// newResponse 把缓存值及其元数据转换为 pb.Response
+func newResponse(val cache.ByteView) *pb.Response {
+	resp := &pb.Response{
+		Value:   val.ByteSlice(),
+		Version: val.Version(),
+		NoCache: val.NoCache(),
+	}
+	if expire := val.Expire(); !expire.IsZero() {
+		// 剩余时间不足 1 毫秒时按 1 毫秒处理, 避免被当成永不过期
+		resp.Ttl = max(1, time.Until(expire).Milliseconds())
+	}
+	return resp
+}
+
+// notFoundResponse 返回 key 不存在的 pb.Response，ttl 为 group 否定结果的存活时间
+func notFoundResponse(group *cache.Group) *pb.Response {
+	return &pb.Response{NotFound: true, Ttl: group.NegativeTTL().Milliseconds()}
+}
+
+// RemoveHandler 处理其他节点发来的删除请求，只删除本节点的缓存
+func RemoveHandler(c *gin.Context) {
+	log.Println(c.Request.Method, c.Request.URL.Path)
+	groupName := c.Query("group")
+	key := c.Query("key")
+	if groupName == "" || key == "" {
+		c.String(http.StatusBadRequest, "group and key must can not be empty")
+		return
+	}
+
+	group := cache.GetGroup(groupName)
+	if group == nil {
+		c.String(http.StatusNotFound, "no such group: "+groupName)
+		return
+	}
+	group.RemoveLocally(key)
+
+	body, err := proto.Marshal(&pb.Response{})
+	if err != nil {
+		c.String(http.StatusInternalServerError, "proto marshal fail")
+		return
+	}
+	c.Data(http.StatusOK, "application/octet-stream", body)
+}
+
+// SetHandler 处理其他节点发来的更新请求，请求体为 protobuf 编码的 SetRequest
+func SetHandler(c *gin.Context) {
+	log.Println(c.Request.Method, c.Request.URL.Path)
+	data, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.String(http.StatusBadRequest, "read body fail")
+		return
+	}
+	req := &pb.SetRequest{}
+	if err := proto.Unmarshal(data, req); err != nil {
+		c.String(http.StatusBadRequest, "proto unmarshal fail")
+		return
+	}
+	if req.Group == "" || req.Key == "" {
+		c.String(http.StatusBadRequest, "group and key must can not be empty")
+		return
+	}
+
+	group := cache.GetGroup(req.Group)
+	if group == nil {
+		c.String(http.StatusNotFound, "no such group: "+req.Group)
+		return
+	}
+	if err := group.SetLocally(req.Key, req.Value); err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	body, err := proto.Marshal(&pb.Response{})
+	if err != nil {
+		c.String(http.StatusInternalServerError, "proto marshal fail")
+		return
+	}
+	c.Data(http.StatusOK, "application/octet-stream", body)
+}
+
+// BatchHandler 处理其他节点发来的批量查询请求，请求体为 protobuf 编码的 BatchRequest
+func BatchHandler(c *gin.Context) {
+	log.Println(c.Request.Method, c.Request.URL.Path)
+	data, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.String(http.StatusBadRequest, "read body fail")
+		return
+	}
+	req := &pb.BatchRequest{}
+	if err := proto.Unmarshal(data, req); err != nil {
+		c.String(http.StatusBadRequest, "proto unmarshal fail")
+		return
+	}
+	if req.Group == "" {
+		c.String(http.StatusBadRequest, "group must can not be empty")
+		return
+	}
+
+	group := cache.GetGroup(req.Group)
+	if group == nil {
+		c.String(http.StatusNotFound, "no such group: "+req.Group)
+		return
+	}
+	ctx, cancel := requestContext(c)
+	defer cancel()
+	values, err := group.GetMultiContext(ctx, req.Keys)
+	if err != nil {
+		// 加载失败的 key 不返回，由调用方自行处理
+		log.Println("[JieCache] get multi failed", err)
+	}
+
+	resp := &pb.BatchResponse{Values: make(map[string]*pb.Response, len(values))}
+	for key, val := range values {
+		resp.Values[key] = newResponse(val)
+	}
+	for _, key := range cache.NotFoundKeys(err) {
+		resp.Values[key] = notFoundResponse(group)
+	}
+	body, err := proto.Marshal(resp)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "proto marshal fail")
 		return
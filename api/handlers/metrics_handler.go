@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"bytes"
+	"github.com/gin-gonic/gin"
+	"jie_cache/cache"
+	"jie_cache/metrics"
+	"jie_cache/peer"
+	"log"
+	"net/http"
+)
+
+// groupMetric 描述一个按 group 输出的指标
+type groupMetric struct {
+	name  string
+	help  string
+	typ   string
+	value func(s cache.Stats) int64
+}
+
+var groupMetrics = []groupMetric{
+	{"jie_cache_gets_total", "Total number of gets, each key of a batch get counts once.", metrics.Counter,
+		func(s cache.Stats) int64 { return s.Gets }},
+	{"jie_cache_hot_cache_hits_total", "Total number of hotCache hits.", metrics.Counter,
+		func(s cache.Stats) int64 { return s.HotCacheHits }},
+	{"jie_cache_main_cache_hits_total", "Total number of mainCache hits.", metrics.Counter,
+		func(s cache.Stats) int64 { return s.MainCacheHits }},
+	{"jie_cache_peer_loads_total", "Total number of keys loaded from peers.", metrics.Counter,
+		func(s cache.Stats) int64 { return s.PeerLoads }},
+	{"jie_cache_peer_errors_total", "Total number of failed loads from peers.", metrics.Counter,
+		func(s cache.Stats) int64 { return s.PeerErrors }},
+	{"jie_cache_local_loads_total", "Total number of keys loaded from the getter.", metrics.Counter,
+		func(s cache.Stats) int64 { return s.LocalLoads }},
+	{"jie_cache_local_load_errors_total", "Total number of failed loads from the getter.", metrics.Counter,
+		func(s cache.Stats) int64 { return s.LocalLoadErrs }},
+	{"jie_cache_negative_hits_total", "Total number of gets answered by the negative cache.", metrics.Counter,
+		func(s cache.Stats) int64 { return s.NegativeHits }},
+	{"jie_cache_filter_rejects_total", "Total number of gets rejected by the bloom filter.", metrics.Counter,
+		func(s cache.Stats) int64 { return s.FilterRejects }},
+	{"jie_cache_stale_hits_total", "Total number of gets answered with an expired value.", metrics.Counter,
+		func(s cache.Stats) int64 { return s.StaleHits }},
+	{"jie_cache_refreshes_total", "Total number of background reloads of stale or expiring keys.", metrics.Counter,
+		func(s cache.Stats) int64 { return s.Refreshes }},
+	{"jie_cache_load_waits_total", "Total number of origin loads that waited for a free slot.", metrics.Counter,
+		func(s cache.Stats) int64 { return s.LoadWaits }},
+	{"jie_cache_origin_in_flight", "Number of getter calls in flight.", metrics.Gauge,
+		func(s cache.Stats) int64 { return s.Origin.InFlight }},
+	{"jie_cache_origin_rejects_total", "Total number of getter calls rejected by the origin guard.", metrics.Counter,
+		func(s cache.Stats) int64 {
+			return s.Origin.CircuitRejects + s.Origin.InFlightRejects + s.Origin.RateRejects
+		}},
+	{"jie_cache_origin_circuit_state", "State of the origin circuit breaker, 0 closed, 1 open, 2 half-open.", metrics.Gauge,
+		func(s cache.Stats) int64 { return int64(s.Origin.State) }},
+	{"jie_cache_singleflight_dedups_total", "Total number of loads deduplicated by singleflight.", metrics.Counter,
+		func(s cache.Stats) int64 { return s.SingleflightDedups }},
+	{"jie_cache_singleflight_in_flight", "Number of loads in flight.", metrics.Gauge,
+		func(s cache.Stats) int64 { return s.InFlightLoads }},
+}
+
+// cacheMetric 描述一个按 group 和缓存类型输出的指标
+type cacheMetric struct {
+	name  string
+	help  string
+	typ   string
+	value func(s cache.CacheStats) int64
+}
+
+var cacheMetrics = []cacheMetric{
+	{"jie_cache_cache_bytes", "Bytes used by the cache.", metrics.Gauge,
+		func(s cache.CacheStats) int64 { return s.Bytes }},
+	{"jie_cache_cache_items", "Number of items in the cache.", metrics.Gauge,
+		func(s cache.CacheStats) int64 { return s.Items }},
+	{"jie_cache_cache_evictions_total", "Total number of evicted or expired items.", metrics.Counter,
+		func(s cache.CacheStats) int64 { return s.Evictions }},
+}
+
+// MetricsHandler 以 Prometheus 文本格式输出 group、缓存、singleflight 以及节点间请求的指标
+func MetricsHandler(c *gin.Context) {
+	groups := cache.Groups()
+	stats := make([]cache.Stats, len(groups))
+	for i, g := range groups {
+		stats[i] = g.Stats()
+	}
+
+	var buf bytes.Buffer
+	w := metrics.NewWriter(&buf)
+	for _, m := range groupMetrics {
+		w.Family(m.name, m.help, m.typ)
+		for i, g := range groups {
+			w.Sample(m.name, float64(m.value(stats[i])), "group", g.Name())
+		}
+	}
+	for _, m := range cacheMetrics {
+		w.Family(m.name, m.help, m.typ)
+		for i, g := range groups {
+			w.Sample(m.name, float64(m.value(stats[i].MainCache)), "group", g.Name(), "cache", "main")
+			w.Sample(m.name, float64(m.value(stats[i].HotCache)), "group", g.Name(), "cache", "hot")
+			w.Sample(m.name, float64(m.value(stats[i].NegativeCache)), "group", g.Name(), "cache", "negative")
+		}
+	}
+
+	transport := peer.TransportMetrics()
+	w.Family("jie_cache_peer_request_duration_seconds", "Latency of requests sent to peers.", metrics.Hist)
+	for _, t := range transport {
+		w.Histogram("jie_cache_peer_request_duration_seconds", t.Latency, "peer", t.Peer, "method", t.Method)
+	}
+	w.Family("jie_cache_peer_request_errors_total", "Total number of failed requests sent to peers.", metrics.Counter)
+	for _, t := range transport {
+		w.Sample("jie_cache_peer_request_errors_total", float64(t.Errors), "peer", t.Peer, "method", t.Method)
+	}
+
+	if err := w.Err(); err != nil {
+		log.Println("[JieCache] write metrics failed", err)
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.Data(http.StatusOK, metrics.ContentType, buf.Bytes())
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"jie_cache/cache"
+	"jie_cache/trace"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// TraceDir 是通过管理接口开启的访问记录写入的目录，文件名由 group 名生成
+var TraceDir = os.TempDir()
+
+// StartTraceHandler 开启 group 的访问记录，可选参数 sample 为采样比例，
+// 已经在记录时先关闭之前的 recorder
+func StartTraceHandler(c *gin.Context) {
+	log.Println(c.Request.Method, c.Request.URL.Path)
+	group, ok := traceGroup(c)
+	if !ok {
+		return
+	}
+	var opts []trace.Option
+	if sample := c.Query("sample"); sample != "" {
+		rate, err := strconv.ParseFloat(sample, 64)
+		if err != nil || rate <= 0 || rate > 1 {
+			c.String(http.StatusBadRequest, "sample must be in (0, 1]")
+			return
+		}
+		opts = append(opts, trace.SampleRate(rate))
+	}
+	recorder, err := trace.NewRecorder(tracePath(group.Name()), opts...)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	if old := group.SetTraceRecorder(recorder); old != nil {
+		old.Close()
+	}
+	c.String(http.StatusOK, recorder.Path())
+}
+
+// StopTraceHandler 停止 group 的访问记录并返回记录的数量
+func StopTraceHandler(c *gin.Context) {
+	log.Println(c.Request.Method, c.Request.URL.Path)
+	group, ok := traceGroup(c)
+	if !ok {
+		return
+	}
+	recorder := group.SetTraceRecorder(nil)
+	if recorder == nil {
+		c.String(http.StatusNotFound, "trace is not running")
+		return
+	}
+	if err := recorder.Close(); err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.String(http.StatusOK, fmt.Sprintf("%s %d", recorder.Path(), recorder.Recorded()))
+}
+
+func traceGroup(c *gin.Context) (*cache.Group, bool) {
+	groupName := c.Query("group")
+	if groupName == "" {
+		c.String(http.StatusBadRequest, "group must can not be empty")
+		return nil, false
+	}
+	group := cache.GetGroup(groupName)
+	if group == nil {
+		c.String(http.StatusNotFound, "no such group: "+groupName)
+		return nil, false
+	}
+	return group, true
+}
+
+// tracePath 返回 group 的访问记录文件，group 名中的特殊字符替换为 _，避免写到 TraceDir 之外
+func tracePath(groupName string) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, groupName)
+	return filepath.Join(TraceDir, "jie_cache_"+name+".trace.csv")
+}
@@ -13,4 +13,10 @@ func NewRouter() *Router {
 
 func (r *Router) SetupRouter(engine *gin.Engine) {
 	engine.GET("/jie_cache", handlers.HTTPHandler)
+	engine.DELETE("/jie_cache", handlers.RemoveHandler)
+	engine.PUT("/jie_cache", handlers.SetHandler)
+	engine.POST("/jie_cache/batch", handlers.BatchHandler)
+	engine.POST("/jie_cache/trace", handlers.StartTraceHandler)
+	engine.DELETE("/jie_cache/trace", handlers.StopTraceHandler)
+	engine.GET("/metrics", handlers.MetricsHandler)
 }
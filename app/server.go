@@ -5,6 +5,7 @@ import (
 	"jie_cache/api"
 	"jie_cache/consistenthash"
 	"jie_cache/peer"
+	"jie_cache/retry"
 	"log"
 	"sync"
 )
@@ -21,6 +22,7 @@ type Server struct {
 	mu          sync.Mutex
 	consistent  *consistenthash.Consistent
 	httpGetters map[string]peer.PeerGetter
+	peerRetry   *retry.Policy // 从其他节点加载失败时的重试策略
 }
 
 func NewServer(mode, host string) *Server {
@@ -36,6 +38,13 @@ func (s *Server) Start() {
 	s.engine.Run(s.host)
 }
 
+// SetPeerRetry 设置从其他节点加载失败时的重试策略，需要在 Set 之前调用
+func (s *Server) SetPeerRetry(policy *retry.Policy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.peerRetry = policy
+}
+
 func (s *Server) Set(nodes ...string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -43,7 +52,7 @@ func (s *Server) Set(nodes ...string) {
 	s.consistent.Add(nodes...)
 	s.httpGetters = make(map[string]peer.PeerGetter, len(nodes))
 	for _, node := range nodes {
-		s.httpGetters[node] = peer.NewHttpGetter(node + basePath)
+		s.httpGetters[node] = peer.NewHttpGetter(node+basePath, peer.Retry(s.peerRetry))
 	}
 }
 
@@ -58,4 +67,17 @@ func (s *Server) PickPeer(key string) (peer.PeerGetter, bool) {
 	return nil, false
 }
 
+// GetAll returns the getters of all nodes except itself
+func (s *Server) GetAll() []peer.PeerGetter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	getters := make([]peer.PeerGetter, 0, len(s.httpGetters))
+	for node, getter := range s.httpGetters {
+		if node != s.host {
+			getters = append(getters, getter)
+		}
+	}
+	return getters
+}
+
 var _ peer.PeerPicker = (*Server)(nil)
@@ -0,0 +1,83 @@
+package bloom
+
+import (
+	"jie_cache/internal/hashing"
+	"math"
+	"sync/atomic"
+)
+
+// Filter 是并发安全的 Bloom filter。
+// MayContain 返回 false 时 key 一定没有加入过，返回 true 时 key 可能加入过
+type Filter struct {
+	bits []uint64 // 按 64 位分组的位数组，用原子操作读写
+	m    uint64   // 位数
+	k    int      // 每个 key 设置的位数
+	n    atomic.Int64
+}
+
+// New 创建一个预计容纳 n 个 key、误判率为 fpRate 的 Filter
+func New(n int, fpRate float64) *Filter {
+	if n < 1 {
+		n = 1
+	}
+	if fpRate <= 0 || fpRate >= 1 {
+		panic("false positive rate must be in (0, 1)")
+	}
+	// m = -n*ln(p)/(ln2)^2, k = m/n*ln2
+	m := uint64(math.Ceil(-float64(n) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	m = max(64, (m+63)/64*64)
+	k := max(1, int(math.Round(float64(m)/float64(n)*math.Ln2)))
+	return &Filter{
+		bits: make([]uint64, m/64),
+		m:    m,
+		k:    k,
+	}
+}
+
+// FromKeys 创建包含 keys 的 Filter
+func FromKeys(keys []string, fpRate float64) *Filter {
+	f := New(len(keys), fpRate)
+	f.Add(keys...)
+	return f
+}
+
+// Add 加入 keys
+func (f *Filter) Add(keys ...string) {
+	for _, key := range keys {
+		h1, h2 := hash(key)
+		for i := 0; i < f.k; i++ {
+			bit := (h1 + uint64(i)*h2) % f.m
+			word, mask := &f.bits[bit/64], uint64(1)<<(bit%64)
+			for {
+				old := atomic.LoadUint64(word)
+				if old&mask != 0 || atomic.CompareAndSwapUint64(word, old, old|mask) {
+					break
+				}
+			}
+		}
+		f.n.Add(1)
+	}
+}
+
+// MayContain 判断 key 是否可能加入过
+func (f *Filter) MayContain(key string) bool {
+	h1, h2 := hash(key)
+	for i := 0; i < f.k; i++ {
+		bit := (h1 + uint64(i)*h2) % f.m
+		if atomic.LoadUint64(&f.bits[bit/64])&(uint64(1)<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Count 返回调用 Add 加入的 key 的数量，重复加入的 key 重复计数
+func (f *Filter) Count() int64 {
+	return f.n.Load()
+}
+
+// hash 用 64 位 FNV-1a 哈希派生出双重哈希需要的两个值, 第二个值保证为奇数
+func hash(key string) (uint64, uint64) {
+	h := hashing.FNV1a(key)
+	return h, hashing.Mix(h) | 1
+}
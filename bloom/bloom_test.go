@@ -0,0 +1,37 @@
+package bloom
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	const n = 10000
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+	}
+	f := FromKeys(keys, 0.01)
+	for _, key := range keys {
+		if !f.MayContain(key) {
+			t.Fatalf("%s was added but reported missing", key)
+		}
+	}
+	falsePositives := 0
+	for i := 0; i < n; i++ {
+		if f.MayContain("other" + strconv.Itoa(i)) {
+			falsePositives++
+		}
+	}
+	if rate := float64(falsePositives) / n; rate > 0.02 {
+		t.Fatalf("false positive rate %.4f is too high", rate)
+	}
+	if f.Count() != n {
+		t.Fatalf("expect count %d, got %d", n, f.Count())
+	}
+
+	f.Add("new")
+	if !f.MayContain("new") {
+		t.Fatal("new was added but reported missing")
+	}
+}
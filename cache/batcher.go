@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// batcher 把一个时间窗口内并发到达的本地加载合并为一次 BatchGetter 调用，
+// 每个 key 仍然经过 singleflight，所以同一个 key 在一个批次中只会出现一次
+type batcher struct {
+	load    loadBatchFunc // 执行一次批量加载
+	window  time.Duration // 收集 key 的时间窗口
+	maxSize int           // 一个批次最多包含的 key 数量, 0代表没有限制
+
+	mu      sync.Mutex
+	pending *batch // 正在收集 key 的批次
+}
+
+// loadBatchFunc 从数据源加载一个批次的 key，cost 是分摊到每个 key 的加载耗时
+type loadBatchFunc func(ctx context.Context, keys []string) (entries map[string]Entry, cost time.Duration, err error)
+
+type batch struct {
+	ctx       context.Context // 批次中第一个 key 的 ctx，只使用其中的值
+	deadline  time.Time       // 成员中最晚的截止时间
+	unbounded bool            // 是否有成员没有截止时间
+	keys      []string
+	done      chan struct{} // 批量加载完成后关闭
+	entries   map[string]Entry
+	cost      time.Duration
+	err       error
+}
+
+func newBatcher(load loadBatchFunc, window time.Duration, maxSize int) *batcher {
+	return &batcher{
+		load:    load,
+		window:  window,
+		maxSize: maxSize,
+	}
+}
+
+// get 把 key 加入当前批次，等待批次加载完成后返回 key 对应的数据和分摊到 key 的加载耗时
+func (b *batcher) get(ctx context.Context, key string) (Entry, time.Duration, error) {
+	b.mu.Lock()
+	bt := b.pending
+	if bt == nil {
+		bt = &batch{ctx: ctx, done: make(chan struct{})}
+		b.pending = bt
+		time.AfterFunc(b.window, func() {
+			b.flush(bt)
+		})
+	}
+	if deadline, ok := ctx.Deadline(); !ok {
+		bt.unbounded = true
+	} else if deadline.After(bt.deadline) {
+		bt.deadline = deadline
+	}
+	bt.keys = append(bt.keys, key)
+	full := b.maxSize > 0 && len(bt.keys) >= b.maxSize
+	if full {
+		// 数量达到上限，不再等待时间窗口
+		b.pending = nil
+	}
+	b.mu.Unlock()
+	if full {
+		go b.run(bt)
+	}
+
+	// 调用方的 ctx 只决定自己等待多久，不影响批次中的其他 key
+	select {
+	case <-bt.done:
+	case <-ctx.Done():
+		return Entry{}, 0, ctx.Err()
+	}
+	if bt.err != nil {
+		return Entry{}, 0, bt.err
+	}
+	entry, ok := bt.entries[key]
+	if !ok {
+		// BatchGetter 没有返回的 key 视为不存在
+		return Entry{}, 0, notFound(key)
+	}
+	return entry, bt.cost, nil
+}
+
+// flush 在时间窗口结束时执行批次
+func (b *batcher) flush(bt *batch) {
+	b.mu.Lock()
+	if b.pending != bt {
+		// 已经因为数量达到上限被提前执行
+		b.mu.Unlock()
+		return
+	}
+	b.pending = nil
+	b.mu.Unlock()
+	b.run(bt)
+}
+
+// run 执行批量加载，批次不会因为某个成员取消而取消，截止时间取成员中最晚的一个
+func (b *batcher) run(bt *batch) {
+	ctx := context.WithoutCancel(bt.ctx)
+	if !bt.unbounded {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, bt.deadline)
+		defer cancel()
+	}
+	bt.entries, bt.cost, bt.err = b.load(ctx, bt.keys)
+	close(bt.done)
+}
@@ -1,8 +1,29 @@
 package cache
 
+import "time"
+
 // A ByteView holds an immutable view of bytes.
 type ByteView struct {
-	b []byte
+	b       []byte
+	e       time.Time // 过期时间, 零值代表永不过期
+	loaded  time.Time // 加载的时间, 用于计算剩余存活时间的比例
+	version int64
+	noCache bool
+}
+
+// Expire returns the time the view expires, the zero time means never.
+func (v ByteView) Expire() time.Time {
+	return v.e
+}
+
+// Version returns the version reported by the origin.
+func (v ByteView) Version() int64 {
+	return v.version
+}
+
+// NoCache reports whether the origin asked not to cache the data.
+func (v ByteView) NoCache() bool {
+	return v.noCache
 }
 
 // Len returns the view's length
@@ -20,6 +41,19 @@ func (v ByteView) String() string {
 	return string(v.b)
 }
 
+// stale 判断 view 在 now 时是否已经过期
+func (v ByteView) stale(now time.Time) bool {
+	return !v.e.IsZero() && now.After(v.e)
+}
+
+// expiring 判断 view 在 now 时剩余的存活时间是否不足 fraction
+func (v ByteView) expiring(now time.Time, fraction float64) bool {
+	if v.e.IsZero() || v.loaded.IsZero() {
+		return false
+	}
+	return v.e.Sub(now) < time.Duration(float64(v.e.Sub(v.loaded))*fraction)
+}
+
 func cloneBytes(b []byte) []byte {
 	c := make([]byte, len(b))
 	copy(c, b)
@@ -1,60 +1,270 @@
 package cache
 
 import (
+	"fmt"
+	"jie_cache/internal/hashing"
 	"jie_cache/strategy"
-	"jie_cache/strategy/lfu"
-	"jie_cache/strategy/lru"
 	"sync"
+	"time"
+
+	// 注册内置的淘汰策略
+	_ "jie_cache/strategy/arc"
+	_ "jie_cache/strategy/clock"
+	_ "jie_cache/strategy/gdsf"
+	_ "jie_cache/strategy/lfu"
+	_ "jie_cache/strategy/lru"
+	_ "jie_cache/strategy/s3fifo"
+	_ "jie_cache/strategy/tinylfu"
 )
 
-// 增加锁来实现并发安全
+// 按 key 的哈希值分片，每个分片单独加锁来实现并发安全
 type Cache struct {
-	mu        sync.Mutex
-	baseCache strategy.BaseCache
+	once      sync.Once
+	shards    []*shard
+	nShards   int // 分片数量
 	maxBytes  int64
-	cacheType string
+	cacheType string           // 淘汰策略注册的名字，使用自定义 Factory 时为空
+	factory   strategy.Factory // 创建每个分片的淘汰策略
+	evictions AtomicInt        // 被淘汰和过期删除的 key 的数量
+	grace     time.Duration    // key 过期后继续保留的时间, 用于返回旧值
+}
+
+type shard struct {
+	mu        sync.RWMutex
+	baseCache strategy.BaseCache
+	// reader 不为空时 baseCache 命中时不移动节点，get 只需要读锁
+	reader strategy.ConcurrentGetter
+}
+
+// CacheStats are statistics of a Cache.
+type CacheStats struct {
+	Bytes     int64
+	Items     int64
+	Evictions int64
 }
 
+// 内置淘汰策略的名字，自定义的淘汰策略通过 strategy.Register 注册
 const (
 	LRU = "LRU"
 	LFU = "LFU"
+	ARC = "ARC"
+	// TinyLFU 是带准入过滤的 W-TinyLFU
+	TinyLFU = "TinyLFU"
+	// CLOCK 和 S3FIFO 命中时只修改访问位或计数器，并发读只需要读锁
+	CLOCK  = "CLOCK"
+	S3FIFO = "S3FIFO"
+	// GDSF 综合 value 大小、访问频率和加载耗时淘汰 key
+	GDSF = "GDSF"
 )
 
 func New(cacheType string, maxBytes int64) *Cache {
-	if cacheType != LRU && cacheType != LFU {
-		panic("don't have this strategy")
+	return NewSharded(cacheType, maxBytes, 1)
+}
+
+// NewSharded 创建一个有 shards 个分片的缓存，每个分片分得 maxBytes 的一部分，
+// cacheType 是通过 strategy.Register 注册的淘汰策略的名字
+func NewSharded(cacheType string, maxBytes int64, shards int) *Cache {
+	c := newCache(cacheType, maxBytes, shards)
+	if c.factory == nil {
+		panic("cacheType is required")
+	}
+	return c
+}
+
+// NewWithFactory 使用自定义的淘汰策略创建有 shards 个分片的缓存
+func NewWithFactory(factory strategy.Factory, maxBytes int64, shards int) *Cache {
+	if factory == nil {
+		panic("nil Factory")
+	}
+	c := newCache("", maxBytes, shards)
+	c.factory = factory
+	return c
+}
+
+// newCache 创建缓存，cacheType 为空时需要之后再设置 factory
+func newCache(cacheType string, maxBytes int64, shards int) *Cache {
+	if shards < 1 {
+		panic("shards must be positive")
 	}
-	return &Cache{
-		mu:        sync.Mutex{},
+	c := &Cache{
+		nShards:   shards,
 		maxBytes:  maxBytes,
 		cacheType: cacheType,
 	}
+	if cacheType != "" {
+		factory, ok := strategy.Lookup(cacheType)
+		if !ok {
+			panic(fmt.Sprintf("don't have this strategy: %s", cacheType))
+		}
+		c.factory = factory
+	}
+	return c
+}
+
+// getShard 返回 key 所在的分片，分片在第一次使用时创建，此时 Option 已经设置完毕
+func (c *Cache) getShard(key string) *shard {
+	c.once.Do(func() {
+		c.shards = make([]*shard, c.nShards)
+		for i := range c.shards {
+			c.shards[i] = &shard{}
+		}
+	})
+	if len(c.shards) == 1 {
+		return c.shards[0]
+	}
+	return c.shards[hashing.FNV1a(key)%uint64(len(c.shards))]
+}
+
+// shardMaxBytes 返回每个分片的最大内存
+func (c *Cache) shardMaxBytes() int64 {
+	if c.maxBytes == 0 {
+		return 0
+	}
+	return max(1, c.maxBytes/int64(c.nShards))
 }
 
 func (c *Cache) add(key string, value ByteView) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	c.addWithCost(key, value, 0)
+}
+
+// addWithCost 添加 key，cost 是从数据源加载它的耗时，0 代表未知。
+// 只有实现了 strategy.CostAdder 的策略会使用 cost
+func (c *Cache) addWithCost(key string, value ByteView, cost time.Duration) {
+	s := c.getShard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	// 延迟创建，节省内存
-	switch c.cacheType {
-	case LFU:
-		c.baseCache = lru.New(c.maxBytes, nil)
-	case LRU:
-		c.baseCache = lfu.New(c.maxBytes, nil)
-	default:
-		panic("Please select the correct algorithm!")
+	if s.baseCache == nil {
+		s.baseCache = c.factory(c.shardMaxBytes(), c.onEvicted)
+		s.reader, _ = s.baseCache.(strategy.ConcurrentGetter)
+	}
+	expire := value.e
+	if !expire.IsZero() {
+		expire = expire.Add(c.grace)
 	}
-	c.baseCache.Add(key, value)
+	if costAdder, ok := s.baseCache.(strategy.CostAdder); ok && cost > 0 {
+		costAdder.AddWithCost(key, value, expire, cost.Seconds())
+		return
+	}
+	s.baseCache.AddWithExpire(key, value, expire)
 }
 
+// get 查询 key，设置了 grace 时可能返回已经过期但仍在保留期内的值
 func (c *Cache) get(key string) (value ByteView, ok bool) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.baseCache == nil {
+	s := c.getShard(key)
+	s.mu.RLock()
+	// 命中时不移动节点的策略只需要读锁，其他策略要升级为写锁
+	if s.reader != nil {
+		defer s.mu.RUnlock()
+		if v, ok := s.reader.ConcurrentGet(key); ok {
+			return v.(ByteView), ok
+		}
+		return
+	}
+	created := s.baseCache != nil
+	s.mu.RUnlock()
+	if !created {
 		return
 	}
 
-	if v, ok := c.baseCache.Get(key); ok {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if v, ok := s.baseCache.Get(key); ok {
 		return v.(ByteView), ok
 	}
 	return
 }
+
+func (c *Cache) remove(key string) {
+	s := c.getShard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.baseCache == nil {
+		return
+	}
+	s.baseCache.Remove(key)
+}
+
+// rangeShards 依次对每个已创建 baseCache 的分片加锁并调用 fn
+func (c *Cache) rangeShards(fn func(baseCache strategy.BaseCache)) {
+	c.getShard("")
+	for _, s := range c.shards {
+		s.mu.Lock()
+		if s.baseCache != nil {
+			fn(s.baseCache)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// removeExpired 清理已过期的 key，返回清理的数量
+func (c *Cache) removeExpired() int {
+	removed := 0
+	c.rangeShards(func(baseCache strategy.BaseCache) {
+		removed += baseCache.RemoveExpired()
+	})
+	return removed
+}
+
+func (c *Cache) onEvicted(string, strategy.Value) {
+	c.evictions.Add(1)
+}
+
+// Stats 返回缓存当前的统计数据
+func (c *Cache) Stats() CacheStats {
+	stats := CacheStats{Evictions: c.evictions.Get()}
+	c.rangeShards(func(baseCache strategy.BaseCache) {
+		stats.Bytes += baseCache.Bytes()
+		stats.Items += int64(baseCache.Len())
+	})
+	return stats
+}
+
+// Len 返回缓存中 key 的数量，包括尚未清理的过期 key
+func (c *Cache) Len() int {
+	n := 0
+	c.rangeShards(func(baseCache strategy.BaseCache) {
+		n += baseCache.Len()
+	})
+	return n
+}
+
+// Bytes 返回缓存当前使用的内存
+func (c *Cache) Bytes() int64 {
+	var n int64
+	c.rangeShards(func(baseCache strategy.BaseCache) {
+		n += baseCache.Bytes()
+	})
+	return n
+}
+
+// Keys 返回缓存中所有未过期的 key，过期后仍在保留期内的 key 不包括在内
+func (c *Cache) Keys() []string {
+	var keys []string
+	c.Range(func(key string, _ ByteView) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// Range 遍历缓存中所有未过期的 key，跳过过期后仍在保留期内的 key，fn 返回 false 时停止遍历。
+// 遍历时持有分片的锁，fn 中不能再访问该缓存
+func (c *Cache) Range(fn func(key string, value ByteView) bool) {
+	now := time.Now()
+	stopped := false
+	c.rangeShards(func(baseCache strategy.BaseCache) {
+		if stopped {
+			return
+		}
+		baseCache.Range(func(key string, value strategy.Value) bool {
+			view := value.(ByteView)
+			if view.stale(now) {
+				return true
+			}
+			stopped = !fn(key, view)
+			return !stopped
+		})
+	})
+}
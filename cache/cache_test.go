@@ -0,0 +1,134 @@
+package cache
+
+import (
+	"fmt"
+	"jie_cache/strategy/lfu"
+	"jie_cache/strategy/lru"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestCacheStrategy(t *testing.T) {
+	for cacheType, check := range map[string]func(c *Cache) bool{
+		LRU: func(c *Cache) bool { _, ok := c.shards[0].baseCache.(*lru.Cache); return ok },
+		LFU: func(c *Cache) bool { _, ok := c.shards[0].baseCache.(*lfu.Cache); return ok },
+	} {
+		c := New(cacheType, 0)
+		for i := 0; i < 3; i++ {
+			key := strconv.Itoa(i)
+			c.add(key, ByteView{b: []byte(key)})
+		}
+		if !check(c) {
+			t.Fatalf("%s cache uses %T", cacheType, c.shards[0].baseCache)
+		}
+		// 每次 add 都使用同一个 baseCache，之前的 key 不会丢失
+		if c.Len() != 3 {
+			t.Fatalf("%s cache lost keys, len %d", cacheType, c.Len())
+		}
+	}
+}
+
+func TestShardedCache(t *testing.T) {
+	c := NewSharded(LRU, 1<<20, 8)
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		c.add(key, ByteView{b: []byte(key)})
+	}
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		if v, ok := c.get(key); !ok || v.String() != key {
+			t.Fatalf("cache miss %s", key)
+		}
+	}
+	if stats := c.Stats(); stats.Items != 100 {
+		t.Fatalf("expect 100 items, got %d", stats.Items)
+	}
+	used := 0
+	for _, s := range c.shards {
+		if s.baseCache != nil {
+			used++
+		}
+	}
+	if used < 2 {
+		t.Fatalf("keys should spread across shards, only %d used", used)
+	}
+}
+
+func BenchmarkCacheGetParallel(b *testing.B) {
+	keys := make([]string, 1<<12)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	for _, cacheType := range []string{LRU, LFU, ARC, TinyLFU, CLOCK, S3FIFO} {
+		for _, shards := range []int{1, 4, 16, 64} {
+			b.Run(fmt.Sprintf("%s/shards=%d", cacheType, shards), func(b *testing.B) {
+				c := NewSharded(cacheType, 0, shards)
+				for _, key := range keys {
+					c.add(key, ByteView{b: []byte(key)})
+				}
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					i := 0
+					for pb.Next() {
+						c.get(keys[i%len(keys)])
+						i++
+					}
+				})
+			})
+		}
+	}
+}
+
+func TestCacheRange(t *testing.T) {
+	c := NewSharded(LFU, 0, 4)
+	for _, key := range []string{"Tom", "Jack", "Sam"} {
+		c.add(key, ByteView{b: []byte(key)})
+	}
+	c.remove("Sam")
+	if c.Len() != 2 || c.Bytes() != 14 {
+		t.Fatalf("unexpected len %d bytes %d", c.Len(), c.Bytes())
+	}
+	visited := 0
+	c.Range(func(key string, value ByteView) bool {
+		if key != value.String() {
+			t.Errorf("unexpected value %s of %s", value, key)
+		}
+		visited++
+		return false
+	})
+	if visited != 1 {
+		t.Fatalf("range should stop after the first key, visited %d", visited)
+	}
+}
+
+func TestConcurrentReads(t *testing.T) {
+	for _, cacheType := range []string{CLOCK, S3FIFO} {
+		c := NewSharded(cacheType, 1<<10, 2)
+		for i := 0; i < 100; i++ {
+			key := strconv.Itoa(i)
+			c.add(key, ByteView{b: []byte(key)})
+		}
+		var wg sync.WaitGroup
+		for g := 0; g < 4; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < 1000; i++ {
+					key := strconv.Itoa(i % 100)
+					if g == 0 {
+						c.add(key, ByteView{b: []byte(key)})
+					} else if v, ok := c.get(key); ok && v.String() != key {
+						t.Errorf("%s: unexpected value %s of %s", cacheType, v, key)
+					}
+				}
+			}(g)
+		}
+		wg.Wait()
+		for _, s := range c.shards {
+			if s.baseCache != nil && s.reader == nil {
+				t.Fatalf("%s should read under a read lock", cacheType)
+			}
+		}
+	}
+}
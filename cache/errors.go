@@ -0,0 +1,48 @@
+package cache
+
+import "errors"
+
+// ErrNotFound 表示 key 在数据源中不存在。Getter 应该返回它或者包装它的错误，
+// 这样才能和数据源故障区分开，开启 NegativeCache 时不存在的 key 会被缓存一段时间
+var ErrNotFound = errors.New("not found")
+
+// KeyError 是批量查询中某个 key 的错误
+type KeyError struct {
+	Key string
+	Err error
+}
+
+func (e *KeyError) Error() string {
+	return e.Key + ": " + e.Err.Error()
+}
+
+func (e *KeyError) Unwrap() error {
+	return e.Err
+}
+
+// notFound 返回 key 不存在的错误
+func notFound(key string) error {
+	return &KeyError{Key: key, Err: ErrNotFound}
+}
+
+// NotFoundKeys 返回 GetMulti 的错误中所有不存在的 key
+func NotFoundKeys(err error) []string {
+	var keys []string
+	var walk func(err error)
+	walk = func(err error) {
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			for _, err := range joined.Unwrap() {
+				walk(err)
+			}
+			return
+		}
+		var keyErr *KeyError
+		if errors.As(err, &keyErr) && errors.Is(keyErr.Err, ErrNotFound) {
+			keys = append(keys, keyErr.Key)
+		}
+	}
+	if err != nil {
+		walk(err)
+	}
+	return keys
+}
@@ -1,5 +1,10 @@
 package cache
 
+import (
+	"context"
+	"time"
+)
+
 // A Getter loads data for a key.
 type Getter interface {
 	Get(key string) ([]byte, error)
@@ -12,3 +17,81 @@ type GetterFunc func(key string) ([]byte, error)
 func (f GetterFunc) Get(key string) ([]byte, error) {
 	return f(key)
 }
+
+// A TTLGetter loads data for a key together with its time-to-live.
+// A ttl <= 0 means the group's default TTL is used.
+type TTLGetter interface {
+	Getter
+	GetWithTTL(key string) ([]byte, time.Duration, error)
+}
+
+// An Entry is the data loaded for a key together with its metadata.
+type Entry struct {
+	Value   []byte
+	TTL     time.Duration // 存活时间, <= 0 时使用 group 的默认 TTL
+	Version int64         // 数据的版本号
+	NoCache bool          // 为 true 时只返回数据, 不写入缓存
+}
+
+// An EntryGetter loads data for a key together with its metadata.
+// The ctx carries the caller's deadline and is done when it expires.
+type EntryGetter interface {
+	Getter
+	GetEntry(ctx context.Context, key string) (Entry, error)
+}
+
+// An EntryGetterFunc implements EntryGetter with a function.
+type EntryGetterFunc func(ctx context.Context, key string) (Entry, error)
+
+// GetEntry implements EntryGetter interface function
+func (f EntryGetterFunc) GetEntry(ctx context.Context, key string) (Entry, error) {
+	return f(ctx, key)
+}
+
+// Get implements Getter interface function
+func (f EntryGetterFunc) Get(key string) ([]byte, error) {
+	entry, err := f(context.Background(), key)
+	return entry.Value, err
+}
+
+// AsEntryGetter adapts a Getter to an EntryGetter, so existing
+// GetterFunc and TTLGetter implementations keep working.
+func AsEntryGetter(getter Getter) EntryGetter {
+	if entryGetter, ok := getter.(EntryGetter); ok {
+		return entryGetter
+	}
+	return entryGetterAdapter{getter}
+}
+
+type entryGetterAdapter struct {
+	Getter
+}
+
+func (a entryGetterAdapter) GetEntry(_ context.Context, key string) (Entry, error) {
+	if getter, ok := a.Getter.(TTLGetter); ok {
+		bytes, ttl, err := getter.GetWithTTL(key)
+		return Entry{Value: bytes, TTL: ttl}, err
+	}
+	bytes, err := a.Getter.Get(key)
+	return Entry{Value: bytes}, err
+}
+
+// A BatchGetter loads data for many keys in one call. When the Getter
+// passed to NewGroup also implements BatchGetter, keys owned by the local
+// node are loaded through it. Keys missing from the result do not exist.
+type BatchGetter interface {
+	GetBatch(ctx context.Context, keys []string) (map[string]Entry, error)
+}
+
+// A Setter persists data for a key to the origin.
+type Setter interface {
+	Set(key string, value []byte) error
+}
+
+// A SetterFunc implements Setter with a function.
+type SetterFunc func(key string, value []byte) error
+
+// Set implements Setter interface function
+func (f SetterFunc) Set(key string, value []byte) error {
+	return f(key, value)
+}
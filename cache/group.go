@@ -1,12 +1,22 @@
 package cache
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"jie_cache/bloom"
+	"jie_cache/guard"
 	"jie_cache/pb"
 	"jie_cache/peer"
+	"jie_cache/retry"
 	"jie_cache/singleflight"
+	"jie_cache/strategy"
+	"jie_cache/strategy/lfu"
+	"jie_cache/trace"
 	"log"
 	"math"
+	"math/rand"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -14,13 +24,32 @@ import (
 
 type Group struct {
 	name               string
-	getter             Getter
+	getter             EntryGetter
+	batchGetter        BatchGetter // getter 支持批量加载时不为 nil
+	batcher            *batcher    // 设置了 BatchWindow 时合并并发的本地加载
+	batchWindow        time.Duration
+	maxBatchSize       int
+	setter             Setter
 	mainCache          *Cache
 	hotCache           *Cache
+	negCache           *Cache        // 缓存不存在的 key, 为 nil 时不缓存否定结果
+	negTTL             time.Duration // 否定结果的存活时间
+	filter             *bloom.Filter // 可能存在的 key, 为 nil 时不过滤
+	refreshAhead       float64       // 剩余存活时间不足这个比例时提前刷新, 0代表不提前刷新
+	refreshing         sync.Map      // 正在后台刷新的 key
+	jitter             ttlJitter     // 加载的 key 的存活时间的随机调整
+	loadSlots          chan struct{} // 数据源加载的名额, 为 nil 时不限制
+	origin             *guard.Guard  // 保护数据源, 为 nil 时不保护
+	loadRetry          *retry.Policy // 从数据源加载失败时的重试策略, 为 nil 时不重试
 	peerPicker         peer.PeerPicker
 	single             *singleflight.Group
+	counters           groupStats
+	statsMu            sync.Mutex
 	stats              map[string]*keyStats
 	maxMinuteRemoteQPS int
+	ttl                time.Duration                  // 默认过期时间, 0代表永不过期
+	cleanupInterval    time.Duration                  // 后台清理过期 key 的间隔
+	recorder           atomic.Pointer[trace.Recorder] // 访问记录, 为空时不记录
 }
 
 type AtomicInt int64 // 封装一个原子类，用于进行原子操作，保证并发安全.
@@ -41,8 +70,9 @@ type keyStats struct {
 }
 
 const (
-	MAX_MINUTE_REMOTE_QPS = 10
-	MAX_BYTES             = 2 << 10
+	MAX_MINUTE_REMOTE_QPS    = 10
+	MAX_BYTES                = 2 << 10
+	DEFAULT_CLEANUP_INTERVAL = time.Minute
 )
 
 var (
@@ -58,16 +88,34 @@ func NewGroup(name string, cacheType string, getter Getter, options ...Option) *
 	defer mu.Unlock()
 	g := &Group{
 		name:               name,
-		getter:             getter,
-		mainCache:          New(cacheType, int64(MAX_BYTES)),
-		hotCache:           New(cacheType, int64(MAX_BYTES/8)),
+		getter:             AsEntryGetter(getter),
+		mainCache:          newCache(cacheType, int64(MAX_BYTES), 1),
+		hotCache:           newCache(cacheType, int64(MAX_BYTES/8), 1),
 		single:             new(singleflight.Group),
 		stats:              make(map[string]*keyStats),
 		maxMinuteRemoteQPS: MAX_MINUTE_REMOTE_QPS,
 	}
+	if batchGetter, ok := getter.(BatchGetter); ok {
+		g.batchGetter = batchGetter
+	}
 	for _, option := range options {
 		option(g)
 	}
+	if g.mainCache.factory == nil {
+		panic("cacheType or WithStrategy is required")
+	}
+	if g.negCache != nil {
+		g.negCache.nShards = g.mainCache.nShards
+	}
+	if g.batchGetter != nil && g.batchWindow > 0 {
+		g.batcher = newBatcher(g.loadBatch, g.batchWindow, g.maxBatchSize)
+	}
+	if g.ttl > 0 && g.cleanupInterval == 0 {
+		g.cleanupInterval = DEFAULT_CLEANUP_INTERVAL
+	}
+	if g.cleanupInterval > 0 {
+		go g.cleanup()
+	}
 	groups[name] = g
 	return g
 }
@@ -88,6 +136,185 @@ func MaxMinuteRemoteQPS(qps int) Option {
 	}
 }
 
+// Shards 设置 mainCache 和 hotCache 的分片数量，每个分片单独加锁，
+// 分得 maxBytes 的一部分
+func Shards(n int) Option {
+	return func(g *Group) {
+		if n < 1 {
+			panic("shards must be positive")
+		}
+		g.mainCache.nShards = n
+		g.hotCache.nShards = n
+	}
+}
+
+// LFUAging 设置 LFU 的频率衰减，例如 LFUAging(lfu.HalveEvery(10000)) 或
+// LFUAging(lfu.HalfLife(time.Hour))，只能用于 LFU 策略
+func LFUAging(opts ...lfu.Option) Option {
+	return func(g *Group) {
+		if g.mainCache.cacheType != LFU {
+			panic("LFUAging only works with LFU")
+		}
+		factory := func(maxBytes int64, onEvicted func(string, strategy.Value)) strategy.BaseCache {
+			return lfu.New(maxBytes, onEvicted, opts...)
+		}
+		g.mainCache.factory = factory
+		g.hotCache.factory = factory
+	}
+}
+
+// WithStrategy 使用自定义的淘汰策略，此时 NewGroup 的 cacheType 可以为空
+func WithStrategy(factory strategy.Factory) Option {
+	return func(g *Group) {
+		if factory == nil {
+			panic("nil Factory")
+		}
+		g.mainCache.cacheType, g.mainCache.factory = "", factory
+		g.hotCache.cacheType, g.hotCache.factory = "", factory
+	}
+}
+
+// TTL 设置 key 的默认过期时间
+func TTL(ttl time.Duration) Option {
+	return func(g *Group) {
+		g.ttl = ttl
+	}
+}
+
+// TTLJitter 让从数据源或远程节点加载的 key 的存活时间在 ±fraction 的范围内随机浮动，
+// 例如 TTLJitter(0.1) 时 10 分钟的 TTL 实际为 9 到 11 分钟，避免预热的 key 同时过期造成缓存雪崩
+func TTLJitter(fraction float64) Option {
+	return func(g *Group) {
+		if fraction <= 0 || fraction >= 1 {
+			panic("ttl jitter fraction must be in (0, 1)")
+		}
+		g.jitter.fraction = fraction
+	}
+}
+
+// TTLJitterRange 让从数据源或远程节点加载的 key 的存活时间随机增加 [0, d)
+func TTLJitterRange(d time.Duration) Option {
+	return func(g *Group) {
+		if d <= 0 {
+			panic("ttl jitter range must be positive")
+		}
+		g.jitter.spread = d
+	}
+}
+
+// MaxConcurrentLoads 限制同时从数据源加载的数量，每次调用 Getter 或 BatchGetter 占用一个名额，
+// BatchWindow 合并的一个批次也只占用一个名额。
+// 超过上限的加载排队等待而不是失败，大量 key 同时过期时数据源的压力平滑上升
+func MaxConcurrentLoads(n int) Option {
+	return func(g *Group) {
+		if n < 1 {
+			panic("max concurrent loads must be positive")
+		}
+		g.loadSlots = make(chan struct{}, n)
+	}
+}
+
+// OriginGuard 在调用 Getter 前检查熔断器、并发数和令牌桶，例如
+// OriginGuard(guard.MaxInFlight(64), guard.RateLimit(1000, 100), guard.CircuitBreaker(5, time.Second))，
+// 被拒绝的加载直接返回 guard.ErrCircuitOpen、guard.ErrInFlightLimit 或 guard.ErrRateLimited。
+// 每次调用 Getter 或 BatchGetter 检查一次，BatchWindow 合并的一个批次也只检查一次；
+// 与 MaxConcurrentLoads 同时使用时，排队拿到加载名额之后才会检查
+func OriginGuard(opts ...guard.Option) Option {
+	return func(g *Group) {
+		g.origin = guard.New(opts...)
+	}
+}
+
+// RetryLoads 设置从数据源加载失败时的重试策略，例如
+// RetryLoads(retry.New(retry.MaxAttempts(3), retry.Backoff(10*time.Millisecond, time.Second), retry.Jitter(0.2)))。
+// ErrNotFound 和 OriginGuard 拒绝的加载不会重试，每次重试都会经过 OriginGuard；
+// 从远程节点加载的重试通过 peer.Retry 设置
+func RetryLoads(policy *retry.Policy) Option {
+	return func(g *Group) {
+		g.loadRetry = policy
+	}
+}
+
+// CleanupInterval 设置后台清理过期 key 的间隔，设置了 TTL 时默认为 DEFAULT_CLEANUP_INTERVAL
+func CleanupInterval(interval time.Duration) Option {
+	return func(g *Group) {
+		g.cleanupInterval = interval
+	}
+}
+
+// BatchWindow 设置合并本地加载的时间窗口，getter 实现了 BatchGetter 时，
+// 窗口内并发未命中的 key 会合并为一次批量加载
+func BatchWindow(window time.Duration) Option {
+	return func(g *Group) {
+		g.batchWindow = window
+	}
+}
+
+// MaxBatchSize 设置一次批量加载最多包含的 key 数量，达到上限时立即加载
+func MaxBatchSize(size int) Option {
+	return func(g *Group) {
+		g.maxBatchSize = size
+	}
+}
+
+// WithSetter 设置 Set 时用于把数据写回数据源的 Setter
+func WithSetter(setter Setter) Option {
+	return func(g *Group) {
+		g.setter = setter
+	}
+}
+
+// NegativeCache 缓存数据源返回 ErrNotFound 的 key，避免不存在的 key 每次都穿透到数据源。
+// ttl 为否定结果的存活时间，maxBytes 为单独的内存上限，大量不存在的 key 不会挤掉正常数据
+func NegativeCache(ttl time.Duration, maxBytes int64) Option {
+	return func(g *Group) {
+		if ttl <= 0 {
+			panic("negative cache ttl must be positive")
+		}
+		g.negCache = New(LRU, maxBytes)
+		g.negTTL = ttl
+	}
+}
+
+// StaleWhileRevalidate 让 key 过期后继续保留 window，期间的查询直接返回旧值，
+// 同时在后台通过 singleflight 重新加载一次，热点 key 过期时不会出现延迟尖刺
+func StaleWhileRevalidate(window time.Duration) Option {
+	return func(g *Group) {
+		if window <= 0 {
+			panic("stale window must be positive")
+		}
+		g.mainCache.grace = window
+		g.hotCache.grace = window
+	}
+}
+
+// RefreshAhead 在 key 剩余的存活时间不足 fraction 时提前在后台重新加载，
+// 例如 RefreshAhead(0.1) 会刷新在最后 10% 的存活时间内被访问的 key
+func RefreshAhead(fraction float64) Option {
+	return func(g *Group) {
+		if fraction <= 0 || fraction >= 1 {
+			panic("refresh ahead fraction must be in (0, 1)")
+		}
+		g.refreshAhead = fraction
+	}
+}
+
+// WithBloomFilter 设置记录可能存在的 key 的 Bloom filter，可以用 bloom.FromKeys 从 key 列表预先加载。
+// filter 判断不存在的 key 直接返回 ErrNotFound，不会访问远程节点和数据源；
+// Set 以及其他节点发来的失效请求会把 key 加入 filter
+func WithBloomFilter(filter *bloom.Filter) Option {
+	return func(g *Group) {
+		g.filter = filter
+	}
+}
+
+// WithTraceRecorder 把 Group 的每次访问记录到 recorder 中，也可以之后通过 SetTraceRecorder 开启
+func WithTraceRecorder(recorder *trace.Recorder) Option {
+	return func(g *Group) {
+		g.recorder.Store(recorder)
+	}
+}
+
 // GetGroup returns the named group previously created with NewGroup, or
 // nil if there's no such group.
 func GetGroup(name string) *Group {
@@ -97,51 +324,697 @@ func GetGroup(name string) *Group {
 	return g
 }
 
+// Groups returns all groups created with NewGroup, sorted by name.
+func Groups() []*Group {
+	mu.RLock()
+	result := make([]*Group, 0, len(groups))
+	for _, g := range groups {
+		result = append(result, g)
+	}
+	mu.RUnlock()
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].name < result[j].name
+	})
+	return result
+}
+
+// Name returns the name of the group.
+func (g *Group) Name() string {
+	return g.name
+}
+
+// MainCache returns the cache holding the keys loaded by this node.
+func (g *Group) MainCache() *Cache {
+	return g.mainCache
+}
+
+// HotCache returns the cache holding the hot keys copied from peers.
+func (g *Group) HotCache() *Cache {
+	return g.hotCache
+}
+
+// SetTraceRecorder 开始把访问记录到 recorder 中，recorder 为 nil 时停止记录，
+// 返回之前的 recorder，由调用方负责关闭
+func (g *Group) SetTraceRecorder(recorder *trace.Recorder) *trace.Recorder {
+	return g.recorder.Swap(recorder)
+}
+
+// TraceRecorder 返回正在使用的 recorder，没有开启访问记录时返回 nil
+func (g *Group) TraceRecorder() *trace.Recorder {
+	return g.recorder.Load()
+}
+
+// record 在开启了访问记录时记录一次访问
+func (g *Group) record(key string, size int, outcome trace.Outcome) {
+	if recorder := g.recorder.Load(); recorder != nil {
+		recorder.Record(key, size, outcome)
+	}
+}
+
+// NegativeTTL 返回否定结果的存活时间，没有开启 NegativeCache 时返回 0
+func (g *Group) NegativeTTL() time.Duration {
+	return g.negTTL
+}
+
+// Keys 返回本节点 mainCache 和 hotCache 中所有未过期的 key，按字典序排列
+func (g *Group) Keys() []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, c := range []*Cache{g.mainCache, g.hotCache} {
+		for _, key := range c.Keys() {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // Get 函数用于获取缓存数据，获取顺序为：热点缓存、主缓存、数据源
 func (g *Group) Get(key string) (ByteView, error) {
+	return g.GetContext(context.Background(), key)
+}
+
+// GetContext 与 Get 相同，ctx 结束时提前返回 ctx.Err()，
+// 同时 ctx 的截止时间会传递给远程节点和数据源
+func (g *Group) GetContext(ctx context.Context, key string) (ByteView, error) {
 	if key == "" {
 		return ByteView{}, fmt.Errorf("key is required")
 	}
+	g.counters.gets.Add(1)
+	if v, ok := g.lookupCache(key); ok {
+		return v, nil
+	}
+	if g.rejectByFilter(key) || g.lookupNegative(key) {
+		return ByteView{}, notFound(key)
+	}
+
+	v, outcome, err := g.load(ctx, key)
+	if err != nil {
+		g.record(key, 0, trace.Error)
+		return v, err
+	}
+	g.record(key, v.Len(), outcome)
+	return v, nil
+}
+
+// lookupCache 依次查询 hotCache 和 mainCache
+func (g *Group) lookupCache(key string) (ByteView, bool) {
 	if v, ok := g.hotCache.get(key); ok {
 		log.Println("[JieCache] hit hotCache")
-		return v, nil
+		g.counters.hotCacheHits.Add(1)
+		g.record(key, v.Len(), trace.Hot)
+		g.maybeRefresh(key, v, true)
+		return v, true
 	}
 	if v, ok := g.mainCache.get(key); ok {
 		log.Println("[JieCache] hit mainCache")
-		return v, nil
+		g.counters.mainCacheHits.Add(1)
+		g.record(key, v.Len(), trace.Main)
+		g.maybeRefresh(key, v, false)
+		return v, true
+	}
+	return ByteView{}, false
+}
+
+// maybeRefresh 在 v 已经过期或即将过期时在后台重新加载 key，hot 表示 v 来自 hotCache
+func (g *Group) maybeRefresh(key string, v ByteView, hot bool) {
+	now := time.Now()
+	if v.stale(now) {
+		g.counters.staleHits.Add(1)
+	} else if g.refreshAhead == 0 || !v.expiring(now, g.refreshAhead) {
+		return
+	}
+	// 同一个 key 同时只有一个后台刷新
+	if _, ok := g.refreshing.LoadOrStore(key, struct{}{}); ok {
+		return
+	}
+	g.counters.refreshes.Add(1)
+	go func() {
+		defer g.refreshing.Delete(key)
+		v, outcome, err := g.load(context.Background(), key)
+		if errors.Is(err, ErrNotFound) {
+			// key 已经不存在，不能再返回旧值
+			g.hotCache.remove(key)
+			g.mainCache.remove(key)
+			return
+		}
+		if err != nil {
+			log.Println("[JieCache] Failed to refresh", key, err)
+			return
+		}
+		// 从远程节点加载的值不一定会进入 hotCache，需要替换掉 hotCache 中的旧值
+		if hot && outcome == trace.Peer && !v.noCache {
+			g.hotCache.add(key, v)
+		}
+	}()
+}
+
+// rejectByFilter 判断 key 是否一定不存在
+func (g *Group) rejectByFilter(key string) bool {
+	if g.filter == nil || g.filter.MayContain(key) {
+		return false
+	}
+	g.counters.filterRejects.Add(1)
+	g.record(key, 0, trace.Rejected)
+	return true
+}
+
+// lookupNegative 查询 key 是否是最近确认过不存在的 key
+func (g *Group) lookupNegative(key string) bool {
+	if g.negCache == nil {
+		return false
+	}
+	if _, ok := g.negCache.get(key); !ok {
+		return false
 	}
+	g.counters.negativeHits.Add(1)
+	g.record(key, 0, trace.Negative)
+	return true
+}
 
-	return g.load(key)
+// populateNegative 缓存不存在的 key，ttl <= 0 时使用 NegativeCache 设置的存活时间
+func (g *Group) populateNegative(key string, ttl time.Duration) {
+	if g.negCache == nil {
+		return
+	}
+	if ttl <= 0 {
+		ttl = g.negTTL
+	}
+	g.negCache.add(key, ByteView{e: time.Now().Add(ttl)})
+}
+
+// GetMulti 批量获取缓存数据
+func (g *Group) GetMulti(keys []string) (map[string]ByteView, error) {
+	return g.GetMultiContext(context.Background(), keys)
 }
 
-func (g *Group) load(key string) (value ByteView, err error) {
-	val, err := g.single.Do(key, func() (interface{}, error) {
+// GetMultiContext 批量获取缓存数据：先查询本地缓存，再把未命中的 key 按归属节点分组，
+// 每个远程节点只发送一次批量请求，属于本节点的 key 通过 BatchGetter 一次加载。
+// 加载失败的 key 不会出现在返回的 map 中，它们的错误合并后返回
+func (g *Group) GetMultiContext(ctx context.Context, keys []string) (map[string]ByteView, error) {
+	values := make(map[string]ByteView, len(keys))
+	missing := make([]string, 0, len(keys))
+	seen := make(map[string]bool, len(keys))
+	var errs []error
+	for _, key := range keys {
+		if key == "" {
+			return nil, fmt.Errorf("key is required")
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		g.counters.gets.Add(1)
+		if v, ok := g.lookupCache(key); ok {
+			values[key] = v
+			continue
+		}
+		if g.rejectByFilter(key) || g.lookupNegative(key) {
+			errs = append(errs, notFound(key))
+			continue
+		}
+		missing = append(missing, key)
+	}
+	if len(missing) == 0 {
+		return values, errors.Join(errs...)
+	}
+
+	// 按归属节点分组
+	var local []string
+	remote := make(map[peer.PeerGetter][]string)
+	for _, key := range missing {
 		if g.peerPicker != nil {
 			if peerGetter, ok := g.peerPicker.PickPeer(key); ok {
-				if view, err := g.getFromPeer(peerGetter, key); err == nil {
-					return view, nil
+				remote[peerGetter] = append(remote[peerGetter], key)
+				continue
+			}
+		}
+		local = append(local, key)
+	}
+
+	var (
+		wg     sync.WaitGroup
+		loadMu sync.Mutex
+	)
+	for peerGetter, peerKeys := range remote {
+		wg.Add(1)
+		go func(peerGetter peer.PeerGetter, peerKeys []string) {
+			defer wg.Done()
+			got, missing, err := g.getMultiFromPeer(ctx, peerGetter, peerKeys)
+			if err != nil {
+				log.Println("[JieCache] Failed to get multi from peer", err)
+			}
+			loadMu.Lock()
+			defer loadMu.Unlock()
+			for _, key := range peerKeys {
+				if v, ok := got[key]; ok {
+					values[key] = v
+					g.record(key, v.Len(), trace.Peer)
+				} else if missing[key] {
+					// 归属节点确认不存在的 key 不再回退到本地加载
+					errs = append(errs, notFound(key))
+					g.record(key, 0, trace.Error)
 				} else {
-					log.Println("[JieCache] Failed to get from peer", err)
+					// 远程节点没有返回的 key 回退到本地加载
+					local = append(local, key)
 				}
 			}
+		}(peerGetter, peerKeys)
+	}
+	wg.Wait()
+	if len(local) == 0 {
+		return values, errors.Join(errs...)
+	}
+	if ctx.Err() != nil {
+		for _, key := range local {
+			g.record(key, 0, trace.Error)
 		}
-		return g.getLocally(key)
+		return values, errors.Join(append(errs, ctx.Err())...)
+	}
+
+	got, err := g.getMultiLocally(ctx, local)
+	for _, key := range local {
+		if v, ok := got[key]; ok {
+			values[key] = v
+			g.record(key, v.Len(), trace.Local)
+		} else {
+			g.record(key, 0, trace.Error)
+		}
+	}
+	return values, errors.Join(append(errs, err)...)
+}
+
+// loaded 是一次加载的结果及其来源，g.single 中保存的结果都是这个类型
+type loaded struct {
+	value   ByteView
+	outcome trace.Outcome
+}
+
+func (g *Group) load(ctx context.Context, key string) (value ByteView, outcome trace.Outcome, err error) {
+	val, err := g.single.DoContext(ctx, key, func(ctx context.Context) (interface{}, error) {
+		if g.peerPicker != nil {
+			if peerGetter, ok := g.peerPicker.PickPeer(key); ok {
+				view, err := g.getFromPeer(ctx, peerGetter, key)
+				if err == nil {
+					return loaded{view, trace.Peer}, nil
+				}
+				// 归属节点确认不存在的 key 不再回退到本地加载，
+				// 归属节点的 Guard 拒绝调用时回退到本地加载会绕过它对数据源的保护
+				if errors.Is(err, ErrNotFound) || guard.Rejected(err) != nil {
+					return nil, err
+				}
+				log.Println("[JieCache] Failed to get from peer", err)
+				// 已经超时则不再回退到本地加载
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+			}
+		}
+		view, err := g.getLocally(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		return loaded{view, trace.Local}, nil
 	})
 	if err == nil {
-		return val.(ByteView), nil
+		l := val.(loaded)
+		return l.value, l.outcome, nil
 	}
 	return
 }
 
-func (g *Group) getLocally(key string) (ByteView, error) {
-	bytes, err := g.getter.Get(key)
+func (g *Group) getLocally(ctx context.Context, key string) (ByteView, error) {
+	var (
+		entry Entry
+		cost  time.Duration // 只包括调用数据源的耗时，不包括等待批次、加载名额和重试的时间
+		err   error
+	)
+	if g.batcher != nil {
+		// 整个批次在 loadBatch 中占用一个加载名额，只经过一次 OriginGuard 和重试
+		entry, cost, err = g.batcher.get(ctx, key)
+	} else {
+		var release func()
+		if release, err = g.acquireLoad(ctx); err != nil {
+			return ByteView{}, err
+		}
+		err = g.retryLoad(ctx, func(ctx context.Context) (err error) {
+			start := time.Now()
+			entry, err = g.getter.GetEntry(ctx, key)
+			cost = time.Since(start)
+			return err
+		})
+		release()
+	}
 	if err != nil {
+		g.counters.localLoadErrs.Add(1)
+		if errors.Is(err, ErrNotFound) {
+			g.populateNegative(key, 0)
+		}
 		return ByteView{}, err
+	}
+	g.counters.localLoads.Add(1)
+	return g.populateCache(key, entry, cost), nil
+}
+
+// getMultiLocally 从数据源加载多个 key，getter 支持批量加载时只调用一次数据源；
+// 启用了 batcher 时每个 key 经过 singleflight 后在 batcher 中合并。
+// 两种方式的每个 key 都登记在 singleflight 中，同时在加载的 Get 不会重复访问数据源
+func (g *Group) getMultiLocally(ctx context.Context, keys []string) (map[string]ByteView, error) {
+	values := make(map[string]ByteView, len(keys))
+	var errs []error
+	if g.batchGetter == nil || g.batcher != nil {
+		var (
+			wg     sync.WaitGroup
+			loadMu sync.Mutex
+		)
+		for _, key := range keys {
+			wg.Add(1)
+			go func(key string) {
+				defer wg.Done()
+				// 与 load 共用 singleflight 的 key，结果必须同样是 loaded
+				v, err := g.single.DoContext(ctx, key, func(ctx context.Context) (interface{}, error) {
+					view, err := g.getLocally(ctx, key)
+					if err != nil {
+						return nil, err
+					}
+					return loaded{view, trace.Local}, nil
+				})
+				loadMu.Lock()
+				defer loadMu.Unlock()
+				if err != nil {
+					errs = append(errs, &KeyError{Key: key, Err: err})
+					return
+				}
+				values[key] = v.(loaded).value
+			}(key)
+		}
+		wg.Wait()
+		return values, errors.Join(errs...)
+	}
+
+	// 已经在加载中的 key 等待已有的结果，其余 key 合并为一次批量加载
+	vals, keyErrs := g.single.DoMulti(ctx, keys, g.loadMultiLocally)
+	for key, v := range vals {
+		values[key] = v.(loaded).value
+	}
+	for key, err := range keyErrs {
+		var keyErr *KeyError
+		if !errors.As(err, &keyErr) {
+			err = &KeyError{Key: key, Err: err}
+		}
+		errs = append(errs, err)
+	}
+	return values, errors.Join(errs...)
+}
+
+// loadMultiLocally 调用一次 GetBatch 加载 keys，为每个 key 返回 loaded 结果或者错误
+func (g *Group) loadMultiLocally(ctx context.Context, keys []string) (map[string]interface{}, map[string]error) {
+	vals := make(map[string]interface{}, len(keys))
+	errs := make(map[string]error)
+	release, err := g.acquireLoad(ctx)
+	if err != nil {
+		for _, key := range keys {
+			errs[key] = err
+		}
+		return vals, errs
+	}
+	entries, cost, err := g.getBatch(ctx, keys)
+	release()
+	if err != nil {
+		g.counters.localLoadErrs.Add(int64(len(keys)))
+		for _, key := range keys {
+			errs[key] = err
+		}
+		return vals, errs
+	}
+	for _, key := range keys {
+		if entry, ok := entries[key]; ok {
+			g.counters.localLoads.Add(1)
+			vals[key] = loaded{g.populateCache(key, entry, cost), trace.Local}
+		} else {
+			// BatchGetter 没有返回的 key 视为不存在
+			g.counters.localLoadErrs.Add(1)
+			g.populateNegative(key, 0)
+			errs[key] = notFound(key)
+		}
+	}
+	return vals, errs
+}
+
+// loadBatch 是 batcher 的一次批量加载，整个批次只占用一个加载名额，只经过一次 OriginGuard 和重试
+func (g *Group) loadBatch(ctx context.Context, keys []string) (map[string]Entry, time.Duration, error) {
+	release, err := g.acquireLoad(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer release()
+	return g.getBatch(ctx, keys)
+}
+
+// getBatch 经过 OriginGuard 和重试调用一次 GetBatch，cost 是最后一次调用的耗时平均分给每个 key 的结果
+func (g *Group) getBatch(ctx context.Context, keys []string) (entries map[string]Entry, cost time.Duration, err error) {
+	err = g.retryLoad(ctx, func(ctx context.Context) (err error) {
+		start := time.Now()
+		entries, err = g.batchGetter.GetBatch(ctx, keys)
+		cost = time.Since(start) / time.Duration(len(keys))
+		return err
+	})
+	return entries, cost, err
+}
+
+// acquireLoad 等待一个数据源加载的名额，返回释放名额的函数，ctx 结束时返回 ctx.Err()
+func (g *Group) acquireLoad(ctx context.Context) (release func(), err error) {
+	if g.loadSlots == nil {
+		return func() {}, nil
+	}
+	select {
+	case g.loadSlots <- struct{}{}:
+	default:
+		g.counters.loadWaits.Add(1)
+		select {
+		case g.loadSlots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return func() { <-g.loadSlots }, nil
+}
+
+// retryLoad 经过 OriginGuard 调用数据源，失败时按 RetryLoads 设置的策略重试
+func (g *Group) retryLoad(ctx context.Context, load func(ctx context.Context) error) error {
+	return g.loadRetry.Do(ctx, func(ctx context.Context) error {
+		done, err := g.guardOrigin(ctx)
+		if err != nil {
+			// 被拒绝说明数据源正在受到保护，重试只会增加压力
+			return retry.Permanent(err)
+		}
+		err = load(ctx)
+		done(err)
+		if errors.Is(err, ErrNotFound) {
+			return retry.Permanent(err)
+		}
+		return err
+	})
+}
+
+// guardOrigin 在设置了 OriginGuard 时申请一次数据源调用，返回报告调用结果的函数
+func (g *Group) guardOrigin(ctx context.Context) (done func(err error), err error) {
+	if g.origin == nil {
+		return func(error) {}, nil
+	}
+	report, err := g.origin.Acquire()
+	if err != nil {
+		return nil, err
+	}
+	return func(err error) {
+		// 不存在的 key、调用方取消和调用方的截止时间已到都不代表数据源出了问题
+		report(err != nil && !errors.Is(err, ErrNotFound) && !errors.Is(err, context.Canceled) && ctx.Err() == nil)
+	}, nil
+}
 
+// populateCache 把数据源返回的数据转换为 ByteView 并写入 mainCache，cost 是加载耗时
+func (g *Group) populateCache(key string, entry Entry, cost time.Duration) ByteView {
+	value := ByteView{
+		b:       cloneBytes(entry.Value),
+		e:       g.expireAt(entry.TTL, g.jitter),
+		loaded:  time.Now(),
+		version: entry.Version,
+		noCache: entry.NoCache,
 	}
-	value := ByteView{b: cloneBytes(bytes)}
-	g.mainCache.add(key, value)
-	return value, nil
+	if !value.noCache {
+		g.mainCache.addWithCost(key, value, cost)
+	}
+	return value
+}
+
+// ttlJitter 描述存活时间的随机调整，零值代表不调整
+type ttlJitter struct {
+	fraction float64       // 在 ±fraction 的比例内随机浮动
+	spread   time.Duration // 再随机增加 [0, spread)
+}
+
+// expireAt 计算过期时间，ttl <= 0 时使用默认过期时间，再按 jitter 随机调整存活时间
+func (g *Group) expireAt(ttl time.Duration, jitter ttlJitter) time.Time {
+	if ttl <= 0 {
+		ttl = g.ttl
+	}
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	if jitter.fraction > 0 {
+		ttl += time.Duration((rand.Float64()*2 - 1) * jitter.fraction * float64(ttl))
+	}
+	if jitter.spread > 0 {
+		ttl += time.Duration(rand.Int63n(int64(jitter.spread)))
+	}
+	return time.Now().Add(ttl)
+}
+
+// cleanup 定期清理 mainCache 和 hotCache 中已过期的 key
+func (g *Group) cleanup() {
+	ticker := time.NewTicker(g.cleanupInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		g.mainCache.removeExpired()
+		g.hotCache.removeExpired()
+	}
+}
+
+// Remove 删除 key, 先通知 key 的归属节点删除，再删除本地缓存，
+// 最后通知其余节点删除可能存在的热点备份
+func (g *Group) Remove(key string) error {
+	return g.RemoveContext(context.Background(), key)
+}
+
+// RemoveContext 与 Remove 相同，ctx 结束时中止发给远程节点的删除请求，
+// 避免一个没有响应的节点让 Remove 一直等待
+func (g *Group) RemoveContext(ctx context.Context, key string) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	if g.peerPicker == nil {
+		g.RemoveLocally(key)
+		return nil
+	}
+
+	// 先删除归属节点的数据，避免本地删除后又从归属节点取回旧值
+	owner, isRemote := g.peerPicker.PickPeer(key)
+	if isRemote {
+		if err := g.removeFromPeer(ctx, owner, key); err != nil {
+			return err
+		}
+	}
+	g.RemoveLocally(key)
+	return g.removeFromPeers(ctx, key, owner)
+}
+
+// removeFromPeers 通知除 except 以外的所有远程节点删除 key
+func (g *Group) removeFromPeers(ctx context.Context, key string, except peer.PeerGetter) error {
+	var (
+		wg    sync.WaitGroup
+		errMu sync.Mutex
+		errs  []error
+	)
+	for _, p := range g.peerPicker.GetAll() {
+		if except != nil && p == except {
+			continue
+		}
+		wg.Add(1)
+		go func(p peer.PeerGetter) {
+			defer wg.Done()
+			if err := g.removeFromPeer(ctx, p, key); err != nil {
+				errMu.Lock()
+				errs = append(errs, err)
+				errMu.Unlock()
+			}
+		}(p)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// RemoveLocally 只删除本节点 mainCache 和 hotCache 中的 key，
+// 用于处理其他节点发来的删除请求
+func (g *Group) RemoveLocally(key string) {
+	// 失效通常意味着数据发生了变化, key 可能是在其他节点上新写入的
+	if g.filter != nil {
+		g.filter.Add(key)
+	}
+	g.hotCache.remove(key)
+	g.mainCache.remove(key)
+	if g.negCache != nil {
+		g.negCache.remove(key)
+	}
+	g.statsMu.Lock()
+	delete(g.stats, key)
+	g.statsMu.Unlock()
+}
+
+func (g *Group) removeFromPeer(ctx context.Context, peer peer.PeerGetter, key string) error {
+	req := &pb.Request{
+		Group: g.name,
+		Key:   key,
+	}
+	return peer.Remove(ctx, req)
+}
+
+// Set 更新 key 的值，由 key 的归属节点写回数据源并缓存新值，
+// 其余节点删除可能存在的旧值
+func (g *Group) Set(key string, value []byte) error {
+	return g.SetContext(context.Background(), key, value)
+}
+
+// SetContext 与 Set 相同，ctx 结束时中止发给远程节点的更新和删除请求
+func (g *Group) SetContext(ctx context.Context, key string, value []byte) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	if g.peerPicker == nil {
+		return g.SetLocally(key, value)
+	}
+
+	owner, isRemote := g.peerPicker.PickPeer(key)
+	if isRemote {
+		if err := g.setToPeer(ctx, owner, key, value); err != nil {
+			return err
+		}
+		// 本节点不是归属节点，只需删除本地可能存在的旧值
+		g.RemoveLocally(key)
+	} else if err := g.SetLocally(key, value); err != nil {
+		return err
+	}
+	return g.removeFromPeers(ctx, key, owner)
+}
+
+// SetLocally 先通过 Setter 写回数据源，再更新本节点的 mainCache，
+// 用于处理其他节点发来的更新请求
+func (g *Group) SetLocally(key string, value []byte) error {
+	if g.setter != nil {
+		if err := g.setter.Set(key, value); err != nil {
+			return err
+		}
+	}
+	if g.filter != nil {
+		g.filter.Add(key)
+	}
+	g.hotCache.remove(key)
+	if g.negCache != nil {
+		g.negCache.remove(key)
+	}
+	g.mainCache.add(key, ByteView{b: cloneBytes(value), e: g.expireAt(0, ttlJitter{}), loaded: time.Now()})
+	return nil
+}
+
+func (g *Group) setToPeer(ctx context.Context, peer peer.PeerGetter, key string, value []byte) error {
+	req := &pb.SetRequest{
+		Group: g.name,
+		Key:   key,
+		Value: value,
+	}
+	return peer.Set(ctx, req)
 }
 
 func (g *Group) RegisterPeerPicker(picker peer.PeerPicker) {
@@ -151,16 +1024,64 @@ func (g *Group) RegisterPeerPicker(picker peer.PeerPicker) {
 	g.peerPicker = picker
 }
 
-func (g *Group) getFromPeer(peer peer.PeerGetter, key string) (ByteView, error) {
+func (g *Group) getFromPeer(ctx context.Context, peer peer.PeerGetter, key string) (ByteView, error) {
 	req := &pb.Request{
 		Group: g.name,
 		Key:   key,
 	}
 	resp := &pb.Response{}
-	err := peer.Get(req, resp)
+	err := peer.Get(ctx, req, resp)
 	if err != nil {
+		g.counters.peerErrors.Add(1)
 		return ByteView{}, err
 	}
+	g.counters.peerLoads.Add(1)
+	if resp.NotFound {
+		g.populateNegative(key, time.Duration(resp.Ttl)*time.Millisecond)
+		return ByteView{}, notFound(key)
+	}
+	return g.populateHotCache(key, resp), nil
+}
+
+// getMultiFromPeer 从远程节点批量加载，返回加载到的值和远程节点确认不存在的 key
+func (g *Group) getMultiFromPeer(ctx context.Context, peer peer.PeerGetter, keys []string) (map[string]ByteView, map[string]bool, error) {
+	req := &pb.BatchRequest{
+		Group: g.name,
+		Keys:  keys,
+	}
+	resp := &pb.BatchResponse{}
+	if err := peer.GetMulti(ctx, req, resp); err != nil {
+		g.counters.peerErrors.Add(1)
+		return nil, nil, err
+	}
+	g.counters.peerLoads.Add(int64(len(resp.Values)))
+	values := make(map[string]ByteView, len(resp.Values))
+	missing := make(map[string]bool)
+	for key, r := range resp.Values {
+		if r.NotFound {
+			g.populateNegative(key, time.Duration(r.Ttl)*time.Millisecond)
+			missing[key] = true
+			continue
+		}
+		values[key] = g.populateHotCache(key, r)
+	}
+	return values, missing, nil
+}
+
+// populateHotCache 把远程节点的响应转换为 ByteView，并根据访问频率决定是否加入 hotCache
+func (g *Group) populateHotCache(key string, resp *pb.Response) ByteView {
+	value := ByteView{
+		b:       resp.Value,
+		e:       g.expireAt(time.Duration(resp.Ttl)*time.Millisecond, g.jitter),
+		loaded:  time.Now(),
+		version: resp.Version,
+		noCache: resp.NoCache,
+	}
+	if value.noCache {
+		return value
+	}
+	g.statsMu.Lock()
+	defer g.statsMu.Unlock()
 	// 更新查询其他节点key的统计数据
 	if stat, ok := g.stats[key]; ok {
 		stat.remoteCnt.Add(1)
@@ -170,11 +1091,9 @@ func (g *Group) getFromPeer(peer peer.PeerGetter, key string) (ByteView, error)
 		qps := stat.remoteCnt.Get() / int64(math.Max(1, math.Round(interval)))
 		if qps >= int64(g.maxMinuteRemoteQPS) {
 			//存入hotCache
-			g.hotCache.add(key, ByteView{b: resp.Value})
+			g.hotCache.add(key, value)
 			//删除映射关系,节省内存
-			mu.Lock()
 			delete(g.stats, key)
-			mu.Unlock()
 		}
 	} else {
 		// 第一次获取
@@ -184,5 +1103,5 @@ func (g *Group) getFromPeer(peer peer.PeerGetter, key string) (ByteView, error)
 		}
 	}
 
-	return ByteView{b: resp.Value}, nil
+	return value
 }
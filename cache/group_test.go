@@ -1,10 +1,28 @@
 package cache
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"jie_cache/bloom"
+	"jie_cache/guard"
+	"jie_cache/pb"
+	"jie_cache/peer"
+	"jie_cache/retry"
+	"jie_cache/strategy"
+	"jie_cache/strategy/lfu"
+	"jie_cache/strategy/lru"
+	"jie_cache/trace"
 	"log"
+	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 var db = map[string]string{
@@ -65,3 +83,1166 @@ func TestGetGroup(t *testing.T) {
 		t.Fatalf("expect nil, but %s got", group.name)
 	}
 }
+
+type fakePeer struct {
+	gets       int
+	removed    []string
+	sets       map[string]string
+	multiCalls int
+}
+
+// fakePeer 上以 missing 开头的 key 不存在，以 rejected 开头的 key 被 Guard 拒绝
+func (p *fakePeer) Get(_ context.Context, req *pb.Request, resp *pb.Response) error {
+	p.gets++
+	if strings.HasPrefix(req.Key, "rejected") {
+		return fmt.Errorf("server returned: 503 Service Unavailable: %w", guard.ErrCircuitOpen)
+	}
+	if strings.HasPrefix(req.Key, "missing") {
+		resp.NotFound = true
+		resp.Ttl = time.Hour.Milliseconds()
+		return nil
+	}
+	resp.Value = []byte("remote:" + req.Key)
+	resp.Ttl = time.Hour.Milliseconds()
+	resp.Version = 7
+	return nil
+}
+
+func (p *fakePeer) GetMulti(_ context.Context, req *pb.BatchRequest, resp *pb.BatchResponse) error {
+	p.multiCalls++
+	resp.Values = make(map[string]*pb.Response, len(req.Keys))
+	for _, key := range req.Keys {
+		if strings.HasPrefix(key, "missing") {
+			resp.Values[key] = &pb.Response{NotFound: true}
+			continue
+		}
+		resp.Values[key] = &pb.Response{Value: []byte("remote:" + key)}
+	}
+	return nil
+}
+
+func (p *fakePeer) Remove(_ context.Context, req *pb.Request) error {
+	p.removed = append(p.removed, req.Key)
+	return nil
+}
+
+func (p *fakePeer) Set(_ context.Context, req *pb.SetRequest) error {
+	if p.sets == nil {
+		p.sets = make(map[string]string)
+	}
+	p.sets[req.Key] = string(req.Value)
+	return nil
+}
+
+type fakePicker struct {
+	owner *fakePeer
+	peers []peer.PeerGetter
+	local map[string]bool // 属于本节点的 key
+}
+
+func (p *fakePicker) PickPeer(key string) (peer.PeerGetter, bool) {
+	if p.owner == nil || p.local[key] {
+		return nil, false
+	}
+	return p.owner, true
+}
+
+func (p *fakePicker) GetAll() []peer.PeerGetter {
+	return p.peers
+}
+
+func TestRemove(t *testing.T) {
+	loadCounts := make(map[string]int, len(db))
+	jie := NewGroup("remove", LRU, GetterFunc(
+		func(key string) ([]byte, error) {
+			loadCounts[key]++
+			return []byte(db[key]), nil
+		}))
+
+	if _, err := jie.Get("Tom"); err != nil {
+		t.Fatal(err)
+	}
+	if err := jie.Remove("Tom"); err != nil {
+		t.Fatal(err)
+	}
+	if view, err := jie.Get("Tom"); err != nil || view.String() != db["Tom"] || loadCounts["Tom"] != 2 {
+		t.Fatalf("Tom should be reloaded after remove, loads %d", loadCounts["Tom"])
+	}
+}
+
+func TestRemoveBroadcast(t *testing.T) {
+	owner, other := &fakePeer{}, &fakePeer{}
+	jie := NewGroup("remove_broadcast", LRU, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(db[key]), nil
+		}))
+	jie.RegisterPeerPicker(&fakePicker{owner: owner, peers: []peer.PeerGetter{owner, other}})
+
+	if err := jie.Remove("Jack"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(owner.removed, []string{"Jack"}) {
+		t.Fatalf("owner should remove Jack once, got %v", owner.removed)
+	}
+	if !reflect.DeepEqual(other.removed, []string{"Jack"}) {
+		t.Fatalf("other peer should remove Jack once, got %v", other.removed)
+	}
+}
+
+func TestSet(t *testing.T) {
+	origin := map[string]string{"Tom": "630"}
+	loadCounts := 0
+	jie := NewGroup("set", LRU, GetterFunc(
+		func(key string) ([]byte, error) {
+			loadCounts++
+			return []byte(origin[key]), nil
+		}), WithSetter(SetterFunc(func(key string, value []byte) error {
+		origin[key] = string(value)
+		return nil
+	})))
+
+	if err := jie.Set("Tom", []byte("700")); err != nil {
+		t.Fatal(err)
+	}
+	if origin["Tom"] != "700" {
+		t.Fatalf("setter should persist Tom=700, got %s", origin["Tom"])
+	}
+	if view, err := jie.Get("Tom"); err != nil || view.String() != "700" || loadCounts != 0 {
+		t.Fatalf("Tom should hit cache after set, got %s, loads %d", view, loadCounts)
+	}
+}
+
+func TestSetToOwner(t *testing.T) {
+	owner, other := &fakePeer{}, &fakePeer{}
+	jie := NewGroup("set_owner", LRU, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(db[key]), nil
+		}))
+	jie.RegisterPeerPicker(&fakePicker{owner: owner, peers: []peer.PeerGetter{owner, other}})
+
+	if err := jie.Set("Sam", []byte("600")); err != nil {
+		t.Fatal(err)
+	}
+	if owner.sets["Sam"] != "600" || len(owner.removed) != 0 {
+		t.Fatalf("owner should receive set only, got sets %v removed %v", owner.sets, owner.removed)
+	}
+	if !reflect.DeepEqual(other.removed, []string{"Sam"}) {
+		t.Fatalf("other peer should drop stale Sam, got %v", other.removed)
+	}
+}
+
+type ttlGetter map[string]time.Duration
+
+func (g ttlGetter) Get(key string) ([]byte, error) {
+	return []byte(db[key]), nil
+}
+
+func (g ttlGetter) GetWithTTL(key string) ([]byte, time.Duration, error) {
+	return []byte(db[key]), g[key], nil
+}
+
+func TestTTL(t *testing.T) {
+	loadCounts := make(map[string]int, len(db))
+	jie := NewGroup("ttl", LRU, GetterFunc(
+		func(key string) ([]byte, error) {
+			loadCounts[key]++
+			return []byte(db[key]), nil
+		}), TTL(20*time.Millisecond))
+
+	jie.Get("Tom")
+	if _, err := jie.Get("Tom"); err != nil || loadCounts["Tom"] != 1 {
+		t.Fatalf("Tom should hit cache before expire, loads %d", loadCounts["Tom"])
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, err := jie.Get("Tom"); err != nil || loadCounts["Tom"] != 2 {
+		t.Fatalf("Tom should be reloaded after expire, loads %d", loadCounts["Tom"])
+	}
+}
+
+func TestTTLGetter(t *testing.T) {
+	jie := NewGroup("ttl_getter", LRU, ttlGetter{"Tom": time.Millisecond}, TTL(time.Hour))
+
+	if view, err := jie.Get("Tom"); err != nil || time.Until(view.Expire()) > time.Millisecond {
+		t.Fatalf("Tom should use the ttl from getter, expire at %v", view.Expire())
+	}
+	if view, err := jie.Get("Jack"); err != nil || time.Until(view.Expire()) < time.Minute {
+		t.Fatalf("Jack should use the default ttl, expire at %v", view.Expire())
+	}
+}
+
+func TestEntryGetter(t *testing.T) {
+	loadCounts := make(map[string]int, len(db))
+	jie := NewGroup("entry_getter", LRU, EntryGetterFunc(
+		func(_ context.Context, key string) (Entry, error) {
+			loadCounts[key]++
+			return Entry{Value: []byte(db[key]), Version: 17, NoCache: key == "Sam"}, nil
+		}))
+
+	if view, err := jie.Get("Tom"); err != nil || view.Version() != 17 {
+		t.Fatalf("Tom should carry version 17, got %d", view.Version())
+	}
+	jie.Get("Tom")
+	jie.Get("Sam")
+	jie.Get("Sam")
+	if loadCounts["Tom"] != 1 || loadCounts["Sam"] != 2 {
+		t.Fatalf("Tom should be cached and Sam should not, loads %v", loadCounts)
+	}
+}
+
+func TestGetFromPeerMetadata(t *testing.T) {
+	jie := NewGroup("peer_metadata", LRU, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(db[key]), nil
+		}))
+	jie.RegisterPeerPicker(&fakePicker{owner: &fakePeer{}})
+
+	view, err := jie.Get("Jack")
+	if err != nil || view.String() != "remote:Jack" || view.Version() != 7 {
+		t.Fatalf("Jack should be loaded from peer with version 7, got %s %d", view, view.Version())
+	}
+	if time.Until(view.Expire()) < time.Minute {
+		t.Fatalf("Jack should carry the ttl from peer, expire at %v", view.Expire())
+	}
+}
+
+func TestGetContext(t *testing.T) {
+	release := make(chan struct{})
+	loaded := make(chan struct{})
+	jie := NewGroup("get_context", LRU, GetterFunc(
+		func(key string) ([]byte, error) {
+			<-release
+			defer close(loaded)
+			return []byte(db[key]), nil
+		}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := jie.GetContext(ctx, "Tom"); err != context.DeadlineExceeded {
+		t.Fatalf("GetContext should give up with deadline exceeded, got %v", err)
+	}
+
+	// 调用方放弃等待不影响加载，加载完成后写入缓存
+	close(release)
+	<-loaded
+	for i := 0; i < 100; i++ {
+		if v, ok := jie.mainCache.get("Tom"); ok && v.String() == db["Tom"] {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("Tom should be cached by the shared load")
+}
+
+type batchGetter struct {
+	mu         sync.Mutex
+	batchCalls int
+	batchKeys  []string
+}
+
+func (g *batchGetter) Get(key string) ([]byte, error) {
+	return []byte(db[key]), nil
+}
+
+func (g *batchGetter) GetBatch(_ context.Context, keys []string) (map[string]Entry, error) {
+	g.mu.Lock()
+	g.batchCalls++
+	g.batchKeys = append(g.batchKeys, keys...)
+	g.mu.Unlock()
+	entries := make(map[string]Entry, len(keys))
+	for _, key := range keys {
+		if v, ok := db[key]; ok {
+			entries[key] = Entry{Value: []byte(v)}
+		}
+	}
+	return entries, nil
+}
+
+func TestGetMulti(t *testing.T) {
+	owner, getter := &fakePeer{}, &batchGetter{}
+	jie := NewGroup("get_multi", LRU, getter)
+	jie.RegisterPeerPicker(&fakePicker{owner: owner, local: map[string]bool{"Tom": true, "Jack": true, "unknown": true}})
+
+	values, err := jie.GetMulti([]string{"Tom", "Jack", "Sam", "Lily", "Tom", "unknown"})
+	if err == nil {
+		t.Fatal("unknown should fail to load")
+	}
+	expect := map[string]string{"Tom": "630", "Jack": "589", "Sam": "remote:Sam", "Lily": "remote:Lily"}
+	if len(values) != len(expect) {
+		t.Fatalf("expect %d values, got %d", len(expect), len(values))
+	}
+	for k, v := range expect {
+		if values[k].String() != v {
+			t.Fatalf("expect %s=%s, got %s", k, v, values[k])
+		}
+	}
+	if owner.multiCalls != 1 || getter.batchCalls != 1 {
+		t.Fatalf("expect one batch per owner, got peer %d local %d", owner.multiCalls, getter.batchCalls)
+	}
+
+	// 本地 key 已缓存，不再访问数据源
+	if _, err := jie.GetMulti([]string{"Tom", "Jack"}); err != nil || getter.batchCalls != 1 {
+		t.Fatalf("Tom and Jack should hit cache, batch calls %d", getter.batchCalls)
+	}
+}
+
+func TestBatchWindow(t *testing.T) {
+	getter := &batchGetter{}
+	jie := NewGroup("batch_window", LRU, getter, BatchWindow(20*time.Millisecond))
+
+	var wg sync.WaitGroup
+	for _, key := range []string{"Tom", "Jack", "Sam", "Tom", "unknown"} {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			view, err := jie.Get(key)
+			if key == "unknown" {
+				if err == nil {
+					t.Error("unknown should not exist")
+				}
+				return
+			}
+			if err != nil || view.String() != db[key] {
+				t.Errorf("get %s failed: %v", key, err)
+			}
+		}(key)
+	}
+	wg.Wait()
+
+	sort.Strings(getter.batchKeys)
+	if getter.batchCalls != 1 || !reflect.DeepEqual(getter.batchKeys, []string{"Jack", "Sam", "Tom", "unknown"}) {
+		t.Fatalf("concurrent misses should be coalesced into one batch, got %d calls %v", getter.batchCalls, getter.batchKeys)
+	}
+}
+
+func TestMaxBatchSize(t *testing.T) {
+	getter := &batchGetter{}
+	jie := NewGroup("max_batch_size", LRU, getter, BatchWindow(time.Hour), MaxBatchSize(3))
+
+	values, err := jie.GetMulti([]string{"Tom", "Jack", "Sam"})
+	if err != nil || len(values) != 3 || getter.batchCalls != 1 {
+		t.Fatalf("a full batch should load without waiting the window, got %d calls: %v", getter.batchCalls, err)
+	}
+}
+
+func TestStats(t *testing.T) {
+	jie := NewGroup("stats", LRU, GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", key)
+		}), MaxBytes(16))
+
+	jie.Get("Tom")
+	jie.Get("Tom")
+	jie.Get("Jack")
+	jie.Get("Sam")
+	jie.Get("unknown")
+
+	stats := jie.Stats()
+	if stats.Gets != 5 || stats.MainCacheHits != 1 || stats.LocalLoads != 3 || stats.LocalLoadErrs != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	// 缓存 Sam 时淘汰 Tom，剩下 Jack(7 字节) 和 Sam(6 字节)
+	if stats.Evictions != 1 || stats.MainCache.Items != 2 || stats.MainCache.Bytes != 13 {
+		t.Fatalf("unexpected cache stats %+v", stats.MainCache)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	jie := NewGroup("keys", LRU, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(db[key]), nil
+		}))
+	jie.Get("Tom")
+	jie.Get("Jack")
+	jie.Get("Tom")
+	if keys := jie.Keys(); !reflect.DeepEqual(keys, []string{"Jack", "Tom"}) {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+	if jie.MainCache().Len() != 2 || jie.HotCache().Len() != 0 {
+		t.Fatal("keys should only be in mainCache")
+	}
+}
+
+func TestLFUAging(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte(db[key]), nil
+	})
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("LFUAging with LRU should panic")
+			}
+		}()
+		NewGroup("lfu_aging_lru", LRU, getter, LFUAging(lfu.HalveEvery(2)))
+	}()
+
+	jie := NewGroup("lfu_aging", LFU, getter, LFUAging(lfu.HalveEvery(2)))
+	for i := 0; i < 3; i++ {
+		for key, score := range db {
+			if v, err := jie.Get(key); err != nil || v.String() != score {
+				t.Fatalf("failed to get %s", key)
+			}
+		}
+	}
+	if stats := jie.Stats(); stats.MainCacheHits != 6 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestGDSFLoadCost(t *testing.T) {
+	jie := NewGroup("gdsf", GDSF, GetterFunc(
+		func(key string) ([]byte, error) {
+			if key == "slow" {
+				time.Sleep(20 * time.Millisecond)
+			}
+			return []byte("123"), nil
+		}), MaxBytes(40))
+	jie.Get("slow")
+	for i := 0; i < 20; i++ {
+		jie.Get(fmt.Sprintf("fast%02d", i))
+	}
+	if _, ok := jie.mainCache.get("slow"); !ok {
+		t.Fatal("slow key should stay in mainCache")
+	}
+	if stats := jie.Stats(); stats.Evictions == 0 {
+		t.Fatal("fast keys should be evicted")
+	}
+}
+
+func TestGDSFLoadCostExcludesRetry(t *testing.T) {
+	attempts := 0
+	jie := NewGroup("gdsf_retry", GDSF, GetterFunc(
+		func(key string) ([]byte, error) {
+			if key == "flaky" {
+				if attempts++; attempts == 1 {
+					return nil, errors.New("boom")
+				}
+				return []byte("123"), nil
+			}
+			time.Sleep(time.Millisecond)
+			return []byte("123"), nil
+		}), MaxBytes(40), RetryLoads(retry.New(retry.Backoff(20*time.Millisecond, 20*time.Millisecond))))
+
+	// 重试前的等待不算加载耗时，flaky 的加载比其他 key 快，最先被淘汰
+	if _, err := jie.Get("flaky"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		jie.Get(fmt.Sprintf("fast%02d", i))
+	}
+	if _, ok := jie.mainCache.get("flaky"); ok {
+		t.Fatal("retry backoff should not count as load cost")
+	}
+}
+
+// customStrategies 记录 TestWithStrategy 注册过的策略数量
+var customStrategies int
+
+func TestWithStrategy(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte(db[key]), nil
+	})
+	created := 0
+	factory := func(maxBytes int64, onEvicted func(string, strategy.Value)) strategy.BaseCache {
+		created++
+		return lru.New(maxBytes, onEvicted)
+	}
+	jie := NewGroup("custom_strategy", "", getter, WithStrategy(factory))
+	if v, err := jie.Get("Tom"); err != nil || v.String() != "630" {
+		t.Fatal("failed to get Tom")
+	}
+	if created != 1 {
+		t.Fatalf("factory should create the mainCache shard, created %d", created)
+	}
+
+	// 注册过的策略可以直接通过名字使用，registry 是全局的，每次运行使用不同的名字
+	customStrategies++
+	name := fmt.Sprintf("%s-%d", t.Name(), customStrategies)
+	strategy.Register(name, factory)
+	jie = NewGroup("registered_strategy", name, getter)
+	jie.Get("Tom")
+	if created != 2 {
+		t.Fatalf("registered factory should be used, created %d", created)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("unknown strategy should panic")
+		}
+	}()
+	NewGroup("unknown_strategy", "unknown", getter)
+}
+
+func TestTraceRecorder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.csv")
+	recorder, err := trace.NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jie := NewGroup("trace", LRU, GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", key)
+		}), WithTraceRecorder(recorder))
+	jie.Get("Tom")
+	jie.Get("Tom")
+	jie.Get("unknown")
+	jie.GetMulti([]string{"Tom", "Jack"})
+
+	if old := jie.SetTraceRecorder(nil); old != recorder {
+		t.Fatal("SetTraceRecorder should return the previous recorder")
+	}
+	jie.Get("Sam") // 停止后不再记录
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		fields := strings.Split(line, ",")
+		got = append(got, fields[2]+","+fields[3])
+	}
+	want := []string{"3,local", "3,main", "0,error", "3,main", "3,local"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected records %v", got)
+	}
+}
+
+func TestNegativeCache(t *testing.T) {
+	loadCounts := make(map[string]int)
+	jie := NewGroup("negative", LRU, GetterFunc(
+		func(key string) ([]byte, error) {
+			loadCounts[key]++
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			if key == "broken" {
+				return nil, fmt.Errorf("db is down")
+			}
+			return nil, fmt.Errorf("%s not exist: %w", key, ErrNotFound)
+		}), NegativeCache(time.Minute, 1<<10))
+
+	for i := 0; i < 3; i++ {
+		if _, err := jie.Get("unknown"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expect ErrNotFound, got %v", err)
+		}
+		if _, err := jie.Get("broken"); err == nil || errors.Is(err, ErrNotFound) {
+			t.Fatalf("expect a real error, got %v", err)
+		}
+	}
+	if loadCounts["unknown"] != 1 || loadCounts["broken"] != 3 {
+		t.Fatalf("only not found results should be cached, loads %v", loadCounts)
+	}
+	if _, err := jie.GetMulti([]string{"unknown", "Tom"}); !reflect.DeepEqual(NotFoundKeys(err), []string{"unknown"}) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if stats := jie.Stats(); stats.NegativeHits != 3 || stats.NegativeCache.Items != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	// Set 之后 key 存在了, 不能再返回否定结果
+	if err := jie.Set("unknown", []byte("100")); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := jie.Get("unknown"); err != nil || v.String() != "100" {
+		t.Fatalf("unknown should exist after Set, got %v", err)
+	}
+}
+
+func TestNegativeCacheFromPeer(t *testing.T) {
+	loads := 0
+	jie := NewGroup("negative_peer", LRU, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte("local"), nil
+		}), NegativeCache(time.Minute, 1<<10))
+	jie.RegisterPeerPicker(&fakePicker{owner: &fakePeer{}})
+
+	if _, err := jie.Get("missing1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expect ErrNotFound from the owner, got %v", err)
+	}
+	if _, err := jie.Get("missing1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expect cached ErrNotFound, got %v", err)
+	}
+	values, err := jie.GetMulti([]string{"missing2", "Tom"})
+	if !reflect.DeepEqual(NotFoundKeys(err), []string{"missing2"}) || values["Tom"].String() != "remote:Tom" {
+		t.Fatalf("unexpected result %v %v", values, err)
+	}
+	if loads != 0 {
+		t.Fatal("keys the owner reported missing should not fall back to the local getter")
+	}
+	if stats := jie.Stats(); stats.NegativeHits != 1 || stats.NegativeCache.Items != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestBloomFilter(t *testing.T) {
+	loads := 0
+	owner := &fakePeer{}
+	jie := NewGroup("bloom", LRU, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte("local"), nil
+		}), WithBloomFilter(bloom.FromKeys([]string{"Tom", "Jack"}, 0.01)))
+	jie.RegisterPeerPicker(&fakePicker{owner: owner, local: map[string]bool{"Jack": true}})
+
+	if v, err := jie.Get("Tom"); err != nil || v.String() != "remote:Tom" {
+		t.Fatalf("preloaded key should be loaded from the owner, got %v %v", v, err)
+	}
+	if v, err := jie.Get("Jack"); err != nil || v.String() != "local" {
+		t.Fatalf("preloaded key should be loaded locally, got %v %v", v, err)
+	}
+	if _, err := jie.Get("Nobody"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expect ErrNotFound, got %v", err)
+	}
+	if _, err := jie.GetMulti([]string{"Jack", "Ghost"}); !reflect.DeepEqual(NotFoundKeys(err), []string{"Ghost"}) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if owner.gets != 1 || owner.multiCalls != 0 || loads != 1 {
+		t.Fatalf("rejected keys should not reach peers or the getter, gets %d multi %d loads %d",
+			owner.gets, owner.multiCalls, loads)
+	}
+	if stats := jie.Stats(); stats.FilterRejects != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	// Set 和失效请求会把 key 加入 filter
+	if err := jie.Set("Nobody", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jie.Get("Nobody"); err != nil {
+		t.Fatalf("key should pass the filter after Set, got %v", err)
+	}
+	jie.RemoveLocally("Ghost")
+	if _, err := jie.Get("Ghost"); err != nil {
+		t.Fatalf("key should pass the filter after invalidation, got %v", err)
+	}
+}
+
+// waitFor 等待 cond 成立，超时后测试失败
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for background refresh")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	var loads atomic.Int64
+	jie := NewGroup("stale", LRU, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(fmt.Sprintf("v%d", loads.Add(1))), nil
+		}), TTL(20*time.Millisecond), StaleWhileRevalidate(time.Minute))
+
+	if v, err := jie.Get("Tom"); err != nil || v.String() != "v1" {
+		t.Fatalf("unexpected value %v %v", v, err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		// 重新加载完成之前一直返回旧值
+		if v, err := jie.Get("Tom"); err != nil || (v.String() != "v1" && v.String() != "v2") {
+			t.Fatalf("stale value should be served, got %v %v", v, err)
+		}
+	}
+	waitFor(t, func() bool {
+		v, _ := jie.MainCache().get("Tom")
+		return v.String() == "v2"
+	})
+	if v, err := jie.Get("Tom"); err != nil || v.String() != "v2" {
+		t.Fatalf("refreshed value should be served, got %v %v", v, err)
+	}
+	if loads.Load() != 2 {
+		t.Fatalf("stale key should be reloaded once, loads %d", loads.Load())
+	}
+	if stats := jie.Stats(); stats.StaleHits == 0 || stats.Refreshes != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestKeysSkipStale(t *testing.T) {
+	jie := NewGroup("keys_stale", LRU, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), TTL(20*time.Millisecond), StaleWhileRevalidate(time.Minute))
+	jie.Get("Tom")
+	time.Sleep(30 * time.Millisecond)
+	jie.Get("Jack")
+
+	// 过期后仍在保留期内的 Tom 不算未过期的 key
+	if keys := jie.Keys(); !reflect.DeepEqual(keys, []string{"Jack"}) {
+		t.Fatalf("expect [Jack], got %v", keys)
+	}
+	if _, ok := jie.MainCache().get("Tom"); !ok {
+		t.Fatal("Tom should still be kept for the grace period")
+	}
+}
+
+func TestRefreshAhead(t *testing.T) {
+	var loads atomic.Int64
+	jie := NewGroup("refresh_ahead", LRU, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(fmt.Sprintf("v%d", loads.Add(1))), nil
+		}), TTL(time.Second), RefreshAhead(0.9))
+
+	if v, err := jie.Get("Tom"); err != nil || v.String() != "v1" {
+		t.Fatalf("unexpected value %v %v", v, err)
+	}
+	time.Sleep(150 * time.Millisecond)
+	// 进入最后 90% 的存活时间，返回当前值并在后台刷新
+	if v, err := jie.Get("Tom"); err != nil || v.String() != "v1" {
+		t.Fatalf("fresh value should be served, got %v %v", v, err)
+	}
+	waitFor(t, func() bool {
+		return loads.Load() == 2
+	})
+	if stats := jie.Stats(); stats.StaleHits != 0 || stats.Refreshes != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestTTLJitter(t *testing.T) {
+	jie := NewGroup("ttl_jitter", LRU, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), TTL(time.Minute), TTLJitter(0.5), TTLJitterRange(time.Second))
+
+	expires := make(map[time.Duration]bool)
+	for i := 0; i < 20; i++ {
+		view, err := jie.Get(fmt.Sprintf("key%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ttl := time.Until(view.Expire()).Round(time.Millisecond)
+		if ttl < 29*time.Second || ttl > 91*time.Second {
+			t.Fatalf("ttl %v out of the jitter range", ttl)
+		}
+		expires[ttl] = true
+	}
+	if len(expires) < 10 {
+		t.Fatalf("ttl should be jittered, got %v", expires)
+	}
+}
+
+func TestMaxConcurrentLoads(t *testing.T) {
+	var running, peak atomic.Int64
+	jie := NewGroup("max_loads", LRU, GetterFunc(
+		func(key string) ([]byte, error) {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			return []byte(key), nil
+		}), MaxConcurrentLoads(2))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := jie.Get(fmt.Sprintf("key%d", i)); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if peak.Load() > 2 {
+		t.Fatalf("at most 2 loads should run at once, got %d", peak.Load())
+	}
+	if stats := jie.Stats(); stats.LoadWaits == 0 || stats.LocalLoads != 8 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	// 排队等待的加载在 ctx 结束时返回
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	jie.loadSlots <- struct{}{}
+	jie.loadSlots <- struct{}{}
+	if _, err := jie.GetContext(ctx, "blocked"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect deadline exceeded, got %v", err)
+	}
+}
+
+func TestOriginGuard(t *testing.T) {
+	loads := 0
+	jie := NewGroup("origin_guard", LRU, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			if strings.HasPrefix(key, "broken") {
+				return nil, fmt.Errorf("db is down")
+			}
+			return nil, fmt.Errorf("%s not exist: %w", key, ErrNotFound)
+		}), OriginGuard(guard.CircuitBreaker(2, time.Hour)))
+
+	// 不存在的 key 不算数据源失败
+	for i := 0; i < 3; i++ {
+		if _, err := jie.Get(fmt.Sprintf("unknown%d", i)); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expect ErrNotFound, got %v", err)
+		}
+	}
+	if state := jie.Stats().Origin.State; state != guard.Closed {
+		t.Fatalf("not found should not open the breaker, got %v", state)
+	}
+
+	for _, key := range []string{"broken1", "broken2"} {
+		if _, err := jie.Get(key); err == nil || errors.Is(err, guard.ErrCircuitOpen) {
+			t.Fatalf("expect the getter error, got %v", err)
+		}
+	}
+	if _, err := jie.Get("Tom"); !errors.Is(err, guard.ErrCircuitOpen) {
+		t.Fatalf("expect ErrCircuitOpen, got %v", err)
+	}
+	if _, err := jie.GetMulti([]string{"Jack"}); !errors.Is(err, guard.ErrCircuitOpen) {
+		t.Fatalf("expect ErrCircuitOpen, got %v", err)
+	}
+	if loads != 5 {
+		t.Fatalf("open breaker should not call the getter, loads %d", loads)
+	}
+	if stats := jie.Stats(); stats.Origin.State != guard.Open || stats.Origin.CircuitRejects != 2 || stats.LocalLoadErrs != 7 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestRetryLoads(t *testing.T) {
+	loadCounts := make(map[string]int)
+	jie := NewGroup("retry_loads", LRU, GetterFunc(
+		func(key string) ([]byte, error) {
+			loadCounts[key]++
+			if v, ok := db[key]; ok {
+				if loadCounts[key] < 3 {
+					return nil, fmt.Errorf("db is busy")
+				}
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist: %w", key, ErrNotFound)
+		}), RetryLoads(retry.New(retry.MaxAttempts(3), retry.Backoff(time.Millisecond, time.Millisecond))))
+
+	if v, err := jie.Get("Tom"); err != nil || v.String() != "630" {
+		t.Fatalf("Tom should be loaded after retries, got %v %v", v, err)
+	}
+	if _, err := jie.Get("unknown"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expect ErrNotFound, got %v", err)
+	}
+	if loadCounts["Tom"] != 3 || loadCounts["unknown"] != 1 {
+		t.Fatalf("not found should not be retried, loads %v", loadCounts)
+	}
+	if stats := jie.Stats(); stats.LocalLoads != 1 || stats.LocalLoadErrs != 1 {
+		t.Fatalf("retries should count as one load, got %+v", stats)
+	}
+}
+
+// echoBatchGetter 对任意 key 返回 key 本身
+type echoBatchGetter struct{}
+
+func (echoBatchGetter) Get(key string) ([]byte, error) {
+	return []byte(key), nil
+}
+
+func (echoBatchGetter) GetBatch(_ context.Context, keys []string) (map[string]Entry, error) {
+	entries := make(map[string]Entry, len(keys))
+	for _, key := range keys {
+		entries[key] = Entry{Value: []byte(key)}
+	}
+	return entries, nil
+}
+
+func TestGetAndGetMultiSameKey(t *testing.T) {
+	jie := NewGroup("get_and_get_multi", LRU, echoBatchGetter{}, BatchWindow(time.Millisecond))
+
+	// Get 和 GetMulti 同时未命中同一个 key 时共用 singleflight
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("key%d", i)
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if v, err := jie.Get(key); err != nil || v.String() != key {
+				t.Errorf("get %s failed: %v %v", key, v, err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if values, err := jie.GetMulti([]string{key}); err != nil || values[key].String() != key {
+				t.Errorf("get multi %s failed: %v %v", key, values, err)
+			}
+		}()
+		wg.Wait()
+	}
+}
+
+func TestBatchWindowNotFound(t *testing.T) {
+	getter := &batchGetter{}
+	jie := NewGroup("batch_window_not_found", LRU, getter, BatchWindow(time.Millisecond),
+		NegativeCache(time.Minute, 1<<10))
+
+	if _, err := jie.Get("unknown"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("key missing from the batch should be ErrNotFound, got %v", err)
+	}
+	if _, err := jie.Get("unknown"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expect cached ErrNotFound, got %v", err)
+	}
+	if getter.batchCalls != 1 {
+		t.Fatalf("missing key should be negatively cached, got %d batch calls", getter.batchCalls)
+	}
+	if stats := jie.Stats(); stats.NegativeCache.Items != 1 || stats.NegativeHits != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestMaxConcurrentLoadsBatch(t *testing.T) {
+	getter := &batchGetter{}
+	jie := NewGroup("max_loads_batch", LRU, getter, BatchWindow(20*time.Millisecond), MaxConcurrentLoads(1))
+
+	// 一个批次只占用一个名额，并发的 key 仍然合并为一次批量加载
+	var wg sync.WaitGroup
+	for _, key := range []string{"Tom", "Jack", "Sam"} {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			if view, err := jie.Get(key); err != nil || view.String() != db[key] {
+				t.Errorf("get %s failed: %v", key, err)
+			}
+		}(key)
+	}
+	wg.Wait()
+	if getter.batchCalls != 1 {
+		t.Fatalf("keys should be loaded in one batch, got %d calls", getter.batchCalls)
+	}
+	if stats := jie.Stats(); stats.LoadWaits != 0 {
+		t.Fatalf("one batch should take one slot, got %+v", stats)
+	}
+}
+
+func TestOriginGuardBatch(t *testing.T) {
+	getter := &batchGetter{}
+	jie := NewGroup("origin_guard_batch", LRU, getter, BatchWindow(20*time.Millisecond),
+		OriginGuard(guard.MaxInFlight(1), guard.CircuitBreaker(1, time.Hour)))
+
+	// 一个批次只占用一个并发名额，批次中不存在的 key 不算数据源失败
+	var wg sync.WaitGroup
+	for _, key := range []string{"Tom", "Jack", "Sam", "unknown"} {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			view, err := jie.Get(key)
+			if key == "unknown" {
+				if !errors.Is(err, ErrNotFound) {
+					t.Errorf("expect ErrNotFound, got %v", err)
+				}
+				return
+			}
+			if err != nil || view.String() != db[key] {
+				t.Errorf("get %s failed: %v", key, err)
+			}
+		}(key)
+	}
+	wg.Wait()
+	if getter.batchCalls != 1 {
+		t.Fatalf("keys should be loaded in one batch, got %d calls", getter.batchCalls)
+	}
+	if origin := jie.Stats().Origin; origin.State != guard.Closed || origin.InFlightRejects != 0 {
+		t.Fatalf("unexpected origin stats %+v", origin)
+	}
+}
+
+func TestRetryLoadsBatchNotFound(t *testing.T) {
+	for _, window := range []time.Duration{0, time.Millisecond} {
+		getter := &batchGetter{}
+		options := []Option{
+			RetryLoads(retry.New(retry.MaxAttempts(3), retry.Backoff(time.Millisecond, time.Millisecond))),
+			OriginGuard(guard.CircuitBreaker(1, time.Hour)),
+		}
+		if window > 0 {
+			options = append(options, BatchWindow(window))
+		}
+		jie := NewGroup("retry_batch_not_found", LRU, getter, options...)
+
+		// 批次中不存在的 key 既不重试，也不会让熔断器打开
+		for i := 0; i < 3; i++ {
+			key := fmt.Sprintf("unknown%d", i)
+			// batchGetter.Get 不区分不存在的 key，没有 batcher 时只测试 GetMulti
+			if _, err := jie.Get(key); window > 0 && !errors.Is(err, ErrNotFound) {
+				t.Fatalf("window %v: expect ErrNotFound, got %v", window, err)
+			}
+			if _, err := jie.GetMulti([]string{key + "-multi"}); !reflect.DeepEqual(NotFoundKeys(err), []string{key + "-multi"}) {
+				t.Fatalf("window %v: unexpected error %v", window, err)
+			}
+		}
+		expect := 3
+		if window > 0 {
+			expect = 6
+		}
+		if getter.batchCalls != expect {
+			t.Fatalf("window %v: missing keys should not be retried, got %d batch calls", window, getter.batchCalls)
+		}
+		if state := jie.Stats().Origin.State; state != guard.Closed {
+			t.Fatalf("window %v: missing keys should not open the breaker, got %v", window, state)
+		}
+	}
+}
+
+// hungPeer 的删除和更新请求直到 ctx 结束才返回
+type hungPeer struct {
+	fakePeer
+}
+
+func (p *hungPeer) Remove(ctx context.Context, _ *pb.Request) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (p *hungPeer) Set(ctx context.Context, _ *pb.SetRequest) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestRemoveContext(t *testing.T) {
+	jie := NewGroup("remove_context", LRU, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(db[key]), nil
+		}))
+	jie.RegisterPeerPicker(&fakePicker{peers: []peer.PeerGetter{&fakePeer{}, &hungPeer{}}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := jie.RemoveContext(ctx, "Tom"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("a hung peer should not block Remove past the deadline, got %v", err)
+	}
+}
+
+func TestSetContext(t *testing.T) {
+	jie := NewGroup("set_context", LRU, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(db[key]), nil
+		}))
+	jie.RegisterPeerPicker(&fakePicker{peers: []peer.PeerGetter{&hungPeer{}}})
+
+	// 本节点是归属节点时，没有响应的节点不能让删除旧值的广播一直等待
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := jie.SetContext(ctx, "Jack", []byte("600")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("a hung peer should not block Set past the deadline, got %v", err)
+	}
+}
+
+// slowBatchGetter 的批量加载需要 delay 才能完成，ctx 先结束时返回 ctx.Err()
+type slowBatchGetter struct {
+	batchGetter
+	delay time.Duration
+}
+
+func (g *slowBatchGetter) GetBatch(ctx context.Context, keys []string) (map[string]Entry, error) {
+	select {
+	case <-time.After(g.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return g.batchGetter.GetBatch(ctx, keys)
+}
+
+func TestBatchWindowCallerDeadline(t *testing.T) {
+	getter := &slowBatchGetter{delay: 30 * time.Millisecond}
+	jie := NewGroup("batch_caller_deadline", LRU, getter, BatchWindow(10*time.Millisecond),
+		OriginGuard(guard.CircuitBreaker(1, time.Hour)))
+
+	// 截止时间较短的调用方只影响自己，不影响同一批次中的其他 key，也不算数据源失败
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+		defer cancel()
+		if _, err := jie.GetContext(ctx, "Tom"); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expect context.DeadlineExceeded, got %v", err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		// 等截止时间较短的调用方先创建批次
+		time.Sleep(2 * time.Millisecond)
+		if view, err := jie.Get("Jack"); err != nil || view.String() != db["Jack"] {
+			t.Errorf("get Jack failed: %v", err)
+		}
+	}()
+	wg.Wait()
+	if getter.batchCalls != 1 {
+		t.Fatalf("keys should be loaded in one batch, got %d calls", getter.batchCalls)
+	}
+	if state := jie.Stats().Origin.State; state != guard.Closed {
+		t.Fatalf("a caller deadline should not open the breaker, got %v", state)
+	}
+}
+
+func TestPeerRejected(t *testing.T) {
+	loads := 0
+	jie := NewGroup("peer_rejected", LRU, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte(key), nil
+		}))
+	jie.RegisterPeerPicker(&fakePicker{owner: &fakePeer{}})
+
+	// 归属节点的 Guard 拒绝调用时不回退到本地加载
+	if _, err := jie.Get("rejected"); !errors.Is(err, guard.ErrCircuitOpen) {
+		t.Fatalf("expect ErrCircuitOpen, got %v", err)
+	}
+	if loads != 0 {
+		t.Fatalf("rejected key should not be loaded locally, loaded %d times", loads)
+	}
+}
+
+// gatedBatchGetter 的 Get 在 release 关闭之前不会返回
+type gatedBatchGetter struct {
+	batchGetter
+	release chan struct{}
+}
+
+func (g *gatedBatchGetter) Get(key string) ([]byte, error) {
+	<-g.release
+	return g.batchGetter.Get(key)
+}
+
+func TestGetMultiJoinsGet(t *testing.T) {
+	getter := &gatedBatchGetter{release: make(chan struct{})}
+	jie := NewGroup("get_multi_joins_get", LRU, getter)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if view, err := jie.Get("Tom"); err != nil || view.String() != db["Tom"] {
+			t.Errorf("get Tom failed: %v", err)
+		}
+	}()
+	waitFor(t, func() bool { return jie.single.InFlight() == 1 })
+
+	// 正在被 Get 加载的 Tom 不再出现在批量加载中
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(getter.release)
+	}()
+	values, err := jie.GetMulti([]string{"Tom", "Jack"})
+	<-done
+	if err != nil || values["Tom"].String() != db["Tom"] || values["Jack"].String() != db["Jack"] {
+		t.Fatalf("unexpected values %v: %v", values, err)
+	}
+	if !reflect.DeepEqual(getter.batchKeys, []string{"Jack"}) {
+		t.Fatalf("Tom should be loaded once by Get, batch keys %v", getter.batchKeys)
+	}
+}
@@ -0,0 +1,72 @@
+package cache
+
+import "jie_cache/guard"
+
+// groupStats 记录 Group 的各项计数，均为原子操作
+type groupStats struct {
+	gets          AtomicInt // 查询次数, 批量查询中每个 key 计一次
+	hotCacheHits  AtomicInt // hotCache 命中次数
+	mainCacheHits AtomicInt // mainCache 命中次数
+	peerLoads     AtomicInt // 从远程节点加载成功的次数
+	peerErrors    AtomicInt // 从远程节点加载失败的次数
+	localLoads    AtomicInt // 从数据源加载成功的次数
+	localLoadErrs AtomicInt // 从数据源加载失败的次数
+	negativeHits  AtomicInt // 命中不存在的 key 的缓存的次数
+	filterRejects AtomicInt // 被 Bloom filter 拒绝的次数
+	staleHits     AtomicInt // 返回已过期旧值的次数
+	refreshes     AtomicInt // 后台重新加载的次数
+	loadWaits     AtomicInt // 等待数据源加载名额的次数
+}
+
+// Stats are a snapshot of the statistics of a Group.
+type Stats struct {
+	Gets               int64
+	HotCacheHits       int64
+	MainCacheHits      int64
+	PeerLoads          int64
+	PeerErrors         int64
+	LocalLoads         int64
+	LocalLoadErrs      int64
+	NegativeHits       int64 // 命中不存在的 key 的缓存的次数
+	FilterRejects      int64 // 被 Bloom filter 判断为不存在的次数
+	StaleHits          int64 // 返回已过期旧值的次数
+	Refreshes          int64 // 因旧值过期或即将过期而在后台重新加载的次数
+	LoadWaits          int64 // 因达到 MaxConcurrentLoads 而等待的数据源加载次数
+	SingleflightDedups int64 // 被 singleflight 合并掉的加载次数
+	InFlightLoads      int64 // 正在进行中的加载数量
+	Evictions          int64 // mainCache 和 hotCache 淘汰的 key 的总数
+	MainCache          CacheStats
+	HotCache           CacheStats
+	NegativeCache      CacheStats  // 没有开启 NegativeCache 时为零值
+	Origin             guard.Stats // 数据源保护的状态, 没有设置 OriginGuard 时为零值
+}
+
+// Stats 返回 Group 当前的统计数据
+func (g *Group) Stats() Stats {
+	stats := Stats{
+		Gets:               g.counters.gets.Get(),
+		HotCacheHits:       g.counters.hotCacheHits.Get(),
+		MainCacheHits:      g.counters.mainCacheHits.Get(),
+		PeerLoads:          g.counters.peerLoads.Get(),
+		PeerErrors:         g.counters.peerErrors.Get(),
+		LocalLoads:         g.counters.localLoads.Get(),
+		LocalLoadErrs:      g.counters.localLoadErrs.Get(),
+		NegativeHits:       g.counters.negativeHits.Get(),
+		FilterRejects:      g.counters.filterRejects.Get(),
+		StaleHits:          g.counters.staleHits.Get(),
+		Refreshes:          g.counters.refreshes.Get(),
+		LoadWaits:          g.counters.loadWaits.Get(),
+		SingleflightDedups: g.single.Dups(),
+		InFlightLoads:      int64(g.single.InFlight()),
+		MainCache:          g.mainCache.Stats(),
+		HotCache:           g.hotCache.Stats(),
+	}
+	if g.negCache != nil {
+		stats.NegativeCache = g.negCache.Stats()
+	}
+	if g.origin != nil {
+		stats.Origin = g.origin.Stats()
+	}
+	stats.Evictions = stats.MainCache.Evictions + stats.HotCache.Evictions
+	return stats
+}
@@ -0,0 +1,109 @@
+// jiecache-sim 用访问 trace 回放所有注册的淘汰策略，比较它们在不同容量下的命中率。
+//
+//	jiecache-sim -capacities 1MB,10MB,100MB access.log
+//	jiecache-sim -keycol 1 -sizecol 2 -header -output json access.csv
+//	jiecache-sim -keycol 1 -sizecol 2 -outcomecol 3 trace.csv trace.csv.1
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"jie_cache/strategy"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	// 注册内置的淘汰策略
+	_ "jie_cache/strategy/arc"
+	_ "jie_cache/strategy/clock"
+	_ "jie_cache/strategy/gdsf"
+	_ "jie_cache/strategy/lfu"
+	_ "jie_cache/strategy/lru"
+	_ "jie_cache/strategy/s3fifo"
+	_ "jie_cache/strategy/tinylfu"
+)
+
+func main() {
+	var (
+		tf         traceFormat
+		capacities string
+		strategies string
+		output     string
+	)
+	flag.StringVar(&tf.format, "format", "auto", "trace format: text, csv or auto (by file extension, rotated files like trace.csv.1 are csv)")
+	flag.IntVar(&tf.keyCol, "keycol", 0, "csv column of the key")
+	flag.IntVar(&tf.sizeCol, "sizecol", 1, "csv column of the value size, -1 if there is none")
+	flag.IntVar(&tf.outcomeCol, "outcomecol", -1, "csv column of the recorded outcome, error/negative/rejected accesses are skipped, -1 if there is none")
+	flag.BoolVar(&tf.header, "header", false, "skip the first csv line")
+	flag.IntVar(&tf.valueSize, "valuesize", 64, "value size when the trace has no size")
+	flag.StringVar(&capacities, "capacities", "1MB,10MB,100MB", "comma separated cache capacities")
+	flag.StringVar(&strategies, "strategies", "", "comma separated strategies, all registered strategies by default")
+	flag.StringVar(&output, "output", "table", "output format: table or json")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] trace...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := tf.validate(); err != nil {
+		fmt.Fprintln(flag.CommandLine.Output(), err)
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var caps []int64
+	for _, s := range splitList(capacities) {
+		capacity, err := parseBytes(s)
+		if err != nil {
+			log.Fatal(err)
+		}
+		caps = append(caps, capacity)
+	}
+	names := splitList(strategies)
+	if len(names) == 0 {
+		names = strategy.Names()
+	}
+	factories := make([]strategy.Factory, len(names))
+	for i, name := range names {
+		factory, ok := strategy.Lookup(name)
+		if !ok {
+			log.Fatalf("unknown strategy %s, registered: %v", name, strategy.Names())
+		}
+		factories[i] = factory
+	}
+
+	trace, err := readTraces(flag.Args(), tf)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var results []result
+	for _, capacity := range caps {
+		for i, name := range names {
+			results = append(results, simulate(name, factories[i], capacity, trace))
+		}
+	}
+
+	switch output {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			log.Fatal(err)
+		}
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "STRATEGY\tCAPACITY\tREQUESTS\tHIT RATIO\tBYTE HIT RATIO\tEVICTIONS\t")
+		for _, r := range results {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%.4f\t%.4f\t%d\t\n",
+				r.Strategy, r.Capacity, r.Requests, r.HitRatio, r.ByteHitRatio, r.Evictions)
+		}
+		w.Flush()
+	default:
+		log.Fatalf("unknown output format %s", output)
+	}
+}
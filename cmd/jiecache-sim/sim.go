@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"jie_cache/strategy"
+	"strconv"
+	"strings"
+)
+
+// value 只记录大小，模拟时不需要真正的数据
+type value int
+
+func (v value) Len() int {
+	return int(v)
+}
+
+// result 是一个淘汰策略在一个容量下的模拟结果
+type result struct {
+	Strategy     string  `json:"strategy"`
+	Capacity     int64   `json:"capacity"`
+	Requests     int64   `json:"requests"`
+	Hits         int64   `json:"hits"`
+	HitRatio     float64 `json:"hit_ratio"`
+	ByteHitRatio float64 `json:"byte_hit_ratio"`
+	Evictions    int64   `json:"evictions"`
+}
+
+// simulate 用 trace 回放一个淘汰策略：命中则计数，未命中则按 value 大小写入缓存
+func simulate(name string, factory strategy.Factory, capacity int64, trace []access) result {
+	r := result{Strategy: name, Capacity: capacity}
+	c := factory(capacity, func(string, strategy.Value) {
+		r.Evictions++
+	})
+	var bytes, hitBytes int64
+	for _, a := range trace {
+		r.Requests++
+		bytes += int64(a.size)
+		if _, ok := c.Get(a.key); ok {
+			r.Hits++
+			hitBytes += int64(a.size)
+			continue
+		}
+		c.Add(a.key, value(a.size))
+	}
+	if r.Requests > 0 {
+		r.HitRatio = float64(r.Hits) / float64(r.Requests)
+	}
+	if bytes > 0 {
+		r.ByteHitRatio = float64(hitBytes) / float64(bytes)
+	}
+	return r
+}
+
+// parseBytes 解析 1024、64KB、10MB、1GB 这样的容量
+func parseBytes(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	unit := int64(1)
+	for _, u := range []struct {
+		suffix string
+		size   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(s, u.suffix) {
+			s, unit = strings.TrimSuffix(s, u.suffix), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid capacity %q", s)
+	}
+	return n * unit, nil
+}
+
+// splitList 把逗号分隔的参数拆成列表，忽略空项
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
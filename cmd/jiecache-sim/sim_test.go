@@ -0,0 +1,88 @@
+package main
+
+import (
+	"jie_cache/strategy"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadTrace(t *testing.T) {
+	tf := traceFormat{keyCol: 1, sizeCol: 2, outcomeCol: -1, header: true, valueSize: 64}
+	trace, err := readCSV(strings.NewReader("ts,key,size\n1,a,10\n2,b,20\n"), tf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(trace, []access{{"a", 10}, {"b", 20}}) {
+		t.Fatalf("unexpected csv trace %v", trace)
+	}
+	if _, err := readCSV(strings.NewReader("1,a,x\n"), traceFormat{keyCol: 1, sizeCol: 2, outcomeCol: -1}, nil); err == nil {
+		t.Fatal("invalid size should fail")
+	}
+
+	trace, err = readText(strings.NewReader("a\n\nb\n"), tf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(trace, []access{{"a", 64}, {"b", 64}}) {
+		t.Fatalf("unexpected text trace %v", trace)
+	}
+}
+
+func TestReadRecorderTrace(t *testing.T) {
+	tf := traceFormat{keyCol: 1, sizeCol: 2, outcomeCol: 3}
+	records := "1,a,10,local\n2,b,0,error\n3,c,0,negative\n4,d,0,rejected\n5,a,10,main\n"
+	trace, err := readCSV(strings.NewReader(records), tf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(trace, []access{{"a", 10}, {"a", 10}}) {
+		t.Fatalf("accesses without a value should be skipped, got %v", trace)
+	}
+
+	for path, want := range map[string]bool{"trace.csv": true, "trace.csv.12": true, "trace.CSV.1": true, "access.log": false, "access.log.1": false, "trace.1": false} {
+		if got := isCSV(path); got != want {
+			t.Fatalf("isCSV(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestValidateColumns(t *testing.T) {
+	for _, tf := range []traceFormat{{keyCol: 0, sizeCol: 1, outcomeCol: -1}, {keyCol: 2, sizeCol: -1, outcomeCol: 3}} {
+		if err := tf.validate(); err != nil {
+			t.Fatalf("%+v should be valid, got %v", tf, err)
+		}
+	}
+	for _, tf := range []traceFormat{{keyCol: -1, sizeCol: 1}, {keyCol: 0, sizeCol: -2}, {keyCol: 0, sizeCol: 1, outcomeCol: -2}} {
+		if err := tf.validate(); err == nil {
+			t.Fatalf("%+v should be rejected", tf)
+		}
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+	for s, want := range map[string]int64{"1024": 1024, "64KB": 64 << 10, "10m": 10 << 20, "1G": 1 << 30} {
+		if got, err := parseBytes(s); err != nil || got != want {
+			t.Fatalf("parseBytes(%q) = %d, %v, want %d", s, got, err, want)
+		}
+	}
+	if _, err := parseBytes("abc"); err == nil {
+		t.Fatal("invalid capacity should fail")
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	trace := []access{{"a", 10}, {"b", 10}, {"a", 10}, {"c", 30}, {"a", 10}}
+	for _, name := range strategy.Names() {
+		factory, _ := strategy.Lookup(name)
+		r := simulate(name, factory, 1<<20, trace)
+		if r.Requests != 5 || r.Hits != 2 || r.HitRatio != 0.4 || r.ByteHitRatio != 20.0/70 || r.Evictions != 0 {
+			t.Fatalf("unexpected result %+v", r)
+		}
+	}
+	factory, _ := strategy.Lookup("LRU")
+	// 容量只能放下一个小 key，放不下 c
+	if r := simulate("LRU", factory, 12, trace); r.Hits != 0 || r.Evictions != 4 {
+		t.Fatalf("unexpected result %+v", r)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"jie_cache/trace"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// access 是 trace 中的一次访问
+type access struct {
+	key  string
+	size int // value 的大小
+}
+
+// traceFormat 描述 trace 文件的格式
+type traceFormat struct {
+	format     string // text、csv 或 auto，auto 按扩展名判断
+	keyCol     int    // csv 中 key 所在的列
+	sizeCol    int    // csv 中 value 大小所在的列，-1 代表没有这一列
+	outcomeCol int    // csv 中 trace.Recorder 记录的访问结果所在的列，-1 代表没有这一列
+	header     bool   // csv 的第一行是否是表头
+	valueSize  int    // 没有大小时使用的 value 大小
+}
+
+// skippedOutcomes 是回放时跳过的访问结果，这些访问没有得到 value，不是一次缓存访问
+var skippedOutcomes = map[string]bool{
+	string(trace.Error):    true,
+	string(trace.Negative): true,
+	string(trace.Rejected): true,
+}
+
+// validate 检查命令行参数给出的列号，负数的列号会让读取 csv 时越界
+func (tf traceFormat) validate() error {
+	if tf.keyCol < 0 {
+		return fmt.Errorf("-keycol must not be negative, got %d", tf.keyCol)
+	}
+	if tf.sizeCol < -1 {
+		return fmt.Errorf("-sizecol must be a column or -1, got %d", tf.sizeCol)
+	}
+	if tf.outcomeCol < -1 {
+		return fmt.Errorf("-outcomecol must be a column or -1, got %d", tf.outcomeCol)
+	}
+	return nil
+}
+
+// isCSV 按扩展名判断是否是 csv，trace.Recorder 轮转出的 trace.csv.1 这类文件同样是 csv
+func isCSV(path string) bool {
+	ext := filepath.Ext(path)
+	if _, err := strconv.Atoi(strings.TrimPrefix(ext, ".")); err == nil && len(ext) > 1 {
+		ext = filepath.Ext(strings.TrimSuffix(path, ext))
+	}
+	return strings.EqualFold(ext, ".csv")
+}
+
+// readTraces 依次读取所有 trace 文件
+func readTraces(paths []string, tf traceFormat) ([]access, error) {
+	var trace []access
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		format := tf.format
+		if format == "auto" {
+			format = "text"
+			if isCSV(path) {
+				format = "csv"
+			}
+		}
+		if format == "csv" {
+			trace, err = readCSV(f, tf, trace)
+		} else {
+			trace, err = readText(f, tf, trace)
+		}
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return trace, nil
+}
+
+// readText 读取每行一个 key 的 trace，忽略空行
+func readText(r io.Reader, tf traceFormat, trace []access) ([]access, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key := strings.TrimSpace(scanner.Text())
+		if key == "" {
+			continue
+		}
+		trace = append(trace, access{key: key, size: tf.valueSize})
+	}
+	return trace, scanner.Err()
+}
+
+// readCSV 读取包含 key 和 value 大小的 csv trace
+func readCSV(r io.Reader, tf traceFormat, trace []access) ([]access, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return trace, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line == 1 && tf.header {
+			continue
+		}
+		if tf.keyCol >= len(record) || tf.sizeCol >= len(record) || tf.outcomeCol >= len(record) {
+			return nil, fmt.Errorf("line %d: too few columns", line)
+		}
+		if tf.outcomeCol >= 0 && skippedOutcomes[strings.TrimSpace(record[tf.outcomeCol])] {
+			continue
+		}
+		a := access{key: record[tf.keyCol], size: tf.valueSize}
+		if tf.sizeCol >= 0 {
+			a.size, err = strconv.Atoi(strings.TrimSpace(record[tf.sizeCol]))
+			if err != nil || a.size < 0 {
+				return nil, fmt.Errorf("line %d: invalid size %q", line, record[tf.sizeCol])
+			}
+		}
+		trace = append(trace, a)
+	}
+}
@@ -0,0 +1,236 @@
+package guard
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// 被 Guard 拒绝时返回的错误
+var (
+	ErrCircuitOpen   = errors.New("guard: circuit breaker is open")
+	ErrInFlightLimit = errors.New("guard: too many calls in flight")
+	ErrRateLimited   = errors.New("guard: rate limit exceeded")
+)
+
+// rejections 是 Guard 拒绝调用时可能返回的全部错误
+var rejections = []error{ErrCircuitOpen, ErrInFlightLimit, ErrRateLimited}
+
+// Rejected 返回 err 对应的拒绝错误，err 不是因为 Guard 拒绝调用产生的时返回 nil
+func Rejected(err error) error {
+	for _, rejected := range rejections {
+		if errors.Is(err, rejected) {
+			return rejected
+		}
+	}
+	return nil
+}
+
+// ParseRejected 根据错误信息找回对应的拒绝错误，用于还原远程节点返回的错误，没有对应的错误时返回 nil
+func ParseRejected(msg string) error {
+	for _, rejected := range rejections {
+		if msg == rejected.Error() {
+			return rejected
+		}
+	}
+	return nil
+}
+
+// State 是熔断器的状态
+type State int
+
+const (
+	Closed   State = iota // 正常调用
+	Open                  // 连续失败次数达到上限，直接拒绝
+	HalfOpen              // 冷却时间结束，只放行一次探测调用
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// MarshalText 让 State 在 JSON 中输出为字符串
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Guard 保护数据源，在调用前依次检查熔断器、并发数和令牌桶，任何一项不满足时直接拒绝。
+// 每次 Acquire 成功后必须调用返回的 done 报告调用结果
+type Guard struct {
+	mu  sync.Mutex
+	now func() time.Time
+
+	maxInFlight int // 0代表不限制
+	inFlight    int
+
+	rate   float64 // 每秒生成的令牌数, 0代表不限制
+	burst  float64 // 令牌桶的容量
+	tokens float64
+	filled time.Time // 上次计算令牌的时间
+
+	threshold int           // 熔断需要的连续失败次数, 0代表不熔断
+	cooldown  time.Duration // 熔断后进入半开状态的等待时间
+	state     State
+	failures  int // 连续失败的次数
+	openedAt  time.Time
+	probing   bool // 半开状态下是否已经放行了探测调用
+	epoch     int  // 熔断器状态每次变化时加一，用来识别在之前的状态中发出的调用
+
+	circuitRejects  int64
+	inFlightRejects int64
+	rateRejects     int64
+}
+
+// Stats 是 Guard 的统计数据
+type Stats struct {
+	State           State
+	InFlight        int64
+	CircuitRejects  int64 // 因熔断被拒绝的次数
+	InFlightRejects int64 // 因并发数达到上限被拒绝的次数
+	RateRejects     int64 // 因令牌不足被拒绝的次数
+}
+
+type Option func(g *Guard)
+
+// MaxInFlight 限制同时进行的调用数量，超过 n 时返回 ErrInFlightLimit
+func MaxInFlight(n int) Option {
+	return func(g *Guard) {
+		if n < 1 {
+			panic("max in flight must be positive")
+		}
+		g.maxInFlight = n
+	}
+}
+
+// RateLimit 使用令牌桶限制每秒最多 perSecond 次调用，允许 burst 次突发，令牌不足时返回 ErrRateLimited
+func RateLimit(perSecond float64, burst int) Option {
+	return func(g *Guard) {
+		if perSecond <= 0 || burst < 1 {
+			panic("rate and burst must be positive")
+		}
+		g.rate = perSecond
+		g.burst = float64(burst)
+		g.tokens = float64(burst)
+	}
+}
+
+// CircuitBreaker 在连续失败 failures 次后熔断，cooldown 内的调用返回 ErrCircuitOpen；
+// cooldown 结束后进入半开状态放行一次探测调用，成功则恢复，失败则重新熔断
+func CircuitBreaker(failures int, cooldown time.Duration) Option {
+	return func(g *Guard) {
+		if failures < 1 || cooldown <= 0 {
+			panic("failures and cooldown must be positive")
+		}
+		g.threshold = failures
+		g.cooldown = cooldown
+	}
+}
+
+func New(opts ...Option) *Guard {
+	g := &Guard{now: time.Now}
+	for _, opt := range opts {
+		opt(g)
+	}
+	g.filled = g.now()
+	return g
+}
+
+// Acquire 申请一次调用，被拒绝时返回 ErrCircuitOpen、ErrInFlightLimit 或 ErrRateLimited。
+// 申请成功时调用结束后必须调用 done，failed 表示这次调用是否失败
+func (g *Guard) Acquire() (done func(failed bool), err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := g.now()
+
+	g.updateState(now)
+	if g.state == Open || (g.state == HalfOpen && g.probing) {
+		g.circuitRejects++
+		return nil, ErrCircuitOpen
+	}
+	if g.maxInFlight > 0 && g.inFlight >= g.maxInFlight {
+		g.inFlightRejects++
+		return nil, ErrInFlightLimit
+	}
+	if g.rate > 0 {
+		g.tokens = min(g.burst, g.tokens+now.Sub(g.filled).Seconds()*g.rate)
+		g.filled = now
+		if g.tokens < 1 {
+			g.rateRejects++
+			return nil, ErrRateLimited
+		}
+		g.tokens--
+	}
+
+	probe, epoch := g.state == HalfOpen, g.epoch
+	if probe {
+		g.probing = true
+	}
+	g.inFlight++
+	var once sync.Once
+	return func(failed bool) {
+		once.Do(func() {
+			g.release(probe, epoch, failed)
+		})
+	}, nil
+}
+
+// updateState 在冷却时间结束后把熔断器切换为半开状态
+func (g *Guard) updateState(now time.Time) {
+	if g.state == Open && now.Sub(g.openedAt) >= g.cooldown {
+		g.setState(HalfOpen)
+		g.probing = false
+	}
+}
+
+func (g *Guard) setState(state State) {
+	g.state = state
+	g.epoch++
+}
+
+// release 报告一次调用的结果，半开状态下只有探测调用的结果能让熔断器恢复或重新熔断
+func (g *Guard) release(probe bool, epoch int, failed bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.inFlight--
+	if probe {
+		g.probing = false
+	}
+	// 在之前的状态中发出的调用返回得晚，它的结果不再代表数据源现在的情况
+	if g.threshold == 0 || epoch != g.epoch {
+		return
+	}
+	if !failed {
+		g.failures = 0
+		if g.state != Closed {
+			g.setState(Closed)
+		}
+		return
+	}
+	g.failures++
+	if g.state == HalfOpen || g.failures >= g.threshold {
+		g.setState(Open)
+		g.openedAt = g.now()
+	}
+}
+
+// Stats 返回 Guard 当前的统计数据
+func (g *Guard) Stats() Stats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.updateState(g.now())
+	return Stats{
+		State:           g.state,
+		InFlight:        int64(g.inFlight),
+		CircuitRejects:  g.circuitRejects,
+		InFlightRejects: g.inFlightRejects,
+		RateRejects:     g.rateRejects,
+	}
+}
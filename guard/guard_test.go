@@ -0,0 +1,158 @@
+package guard
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMaxInFlight(t *testing.T) {
+	g := New(MaxInFlight(2))
+	done1, err1 := g.Acquire()
+	_, err2 := g.Acquire()
+	if err1 != nil || err2 != nil {
+		t.Fatal(err1, err2)
+	}
+	if _, err := g.Acquire(); !errors.Is(err, ErrInFlightLimit) {
+		t.Fatalf("expect ErrInFlightLimit, got %v", err)
+	}
+	done1(false)
+	done1(false) // 重复调用 done 只释放一次
+	if _, err := g.Acquire(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := g.Stats(); stats.InFlight != 2 || stats.InFlightRejects != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	now := time.Unix(0, 0)
+	g := New(RateLimit(10, 2))
+	g.now = func() time.Time { return now }
+	g.filled = now
+
+	for i := 0; i < 2; i++ {
+		done, err := g.Acquire()
+		if err != nil {
+			t.Fatalf("burst call %d should pass, got %v", i, err)
+		}
+		done(false)
+	}
+	if _, err := g.Acquire(); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expect ErrRateLimited, got %v", err)
+	}
+	// 100ms 生成一个令牌
+	now = now.Add(100 * time.Millisecond)
+	if _, err := g.Acquire(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Acquire(); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expect ErrRateLimited, got %v", err)
+	}
+	if stats := g.Stats(); stats.RateRejects != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Unix(0, 0)
+	g := New(CircuitBreaker(3, time.Second))
+	g.now = func() time.Time { return now }
+
+	call := func(failed bool) error {
+		done, err := g.Acquire()
+		if err != nil {
+			return err
+		}
+		done(failed)
+		return nil
+	}
+	// 成功会清零连续失败次数
+	call(true)
+	call(true)
+	call(false)
+	call(true)
+	call(true)
+	if g.Stats().State != Closed {
+		t.Fatal("breaker should stay closed without 3 consecutive failures")
+	}
+	call(true)
+	if err := call(false); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expect ErrCircuitOpen, got %v", err)
+	}
+
+	// 冷却结束后只放行一次探测，探测失败重新熔断
+	now = now.Add(time.Second)
+	if state := g.Stats().State; state != HalfOpen {
+		t.Fatalf("expect half-open, got %v", state)
+	}
+	probe, err := g.Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Acquire(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("only one probe is allowed, got %v", err)
+	}
+	probe(true)
+	if state := g.Stats().State; state != Open {
+		t.Fatalf("failed probe should reopen, got %v", state)
+	}
+
+	// 探测成功后恢复
+	now = now.Add(time.Second)
+	if err := call(false); err != nil {
+		t.Fatal(err)
+	}
+	if stats := g.Stats(); stats.State != Closed || stats.CircuitRejects != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestCircuitBreakerLateResult(t *testing.T) {
+	now := time.Unix(0, 0)
+	g := New(CircuitBreaker(1, time.Second))
+	g.now = func() time.Time { return now }
+
+	// 熔断之前发出的调用在熔断或半开之后才返回，结果都被忽略
+	late, _ := g.Acquire()
+	lateSuccess, _ := g.Acquire()
+	lateFailure, _ := g.Acquire()
+	failed, _ := g.Acquire()
+	failed(true)
+	late(false)
+	if state := g.Stats().State; state != Open {
+		t.Fatalf("a late success should not close the breaker, got %v", state)
+	}
+	now = now.Add(time.Second)
+	probe, err := g.Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lateSuccess(false)
+	lateFailure(true)
+	if state := g.Stats().State; state != HalfOpen {
+		t.Fatalf("only the probe should end the half-open state, got %v", state)
+	}
+	probe(false)
+	if stats := g.Stats(); stats.State != Closed || stats.InFlight != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestRejected(t *testing.T) {
+	err := fmt.Errorf("load: %w", ErrInFlightLimit)
+	if rejected := Rejected(err); rejected != ErrInFlightLimit {
+		t.Fatalf("expect ErrInFlightLimit, got %v", rejected)
+	}
+	if rejected := Rejected(errors.New("boom")); rejected != nil {
+		t.Fatalf("expect nil, got %v", rejected)
+	}
+	if rejected := ParseRejected(ErrRateLimited.Error()); rejected != ErrRateLimited {
+		t.Fatalf("expect ErrRateLimited, got %v", rejected)
+	}
+	if rejected := ParseRejected("server error"); rejected != nil {
+		t.Fatalf("expect nil, got %v", rejected)
+	}
+}
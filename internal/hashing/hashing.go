@@ -0,0 +1,20 @@
+// Package hashing 提供各个包共用的非加密哈希函数
+package hashing
+
+// FNV1a 返回 key 的 64 位 FNV-1a 哈希，与 hash/fnv 的 New64a 结果相同，但不需要分配内存
+func FNV1a(key string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= 1099511628211
+	}
+	return h
+}
+
+// Mix 打乱 h 的各个位，让高位也分布均匀，用于从一个哈希值派生出另一个哈希值
+func Mix(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	return h
+}
@@ -0,0 +1,16 @@
+package hashing
+
+import (
+	"hash/fnv"
+	"testing"
+)
+
+func TestFNV1a(t *testing.T) {
+	for _, key := range []string{"", "a", "jie_cache", "hot0-01"} {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		if got, expect := FNV1a(key), h.Sum64(); got != expect {
+			t.Fatalf("FNV1a(%q) = %x, expect %x", key, got, expect)
+		}
+	}
+}
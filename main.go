@@ -6,8 +6,10 @@ import (
 	"github.com/gin-gonic/gin"
 	"jie_cache/app"
 	"jie_cache/cache"
+	"jie_cache/retry"
 	"log"
 	"net/http"
+	"time"
 )
 
 var db = map[string]string{
@@ -23,12 +25,14 @@ func createGroup() *cache.Group {
 			if v, ok := db[key]; ok {
 				return []byte(v), nil
 			}
-			return nil, fmt.Errorf("%s not exist", key)
-		}), cache.MaxMinuteRemoteQPS(2))
+			return nil, fmt.Errorf("%s not exist: %w", key, cache.ErrNotFound)
+		}), cache.MaxMinuteRemoteQPS(2), cache.NegativeCache(10*time.Second, 1<<20),
+		cache.RetryLoads(retry.New(retry.MaxAttempts(3), retry.Jitter(0.2))))
 }
 
 func startCacheServer(addr string, addrs []string, group *cache.Group) {
 	server := app.NewServer(gin.ReleaseMode, addr)
+	server.SetPeerRetry(retry.New(retry.MaxAttempts(2), retry.Jitter(0.2)))
 	server.Set(addrs...)
 	group.RegisterPeerPicker(server)
 	log.Println("cache is running at", addr)
@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"sync/atomic"
+)
+
+// DefBuckets are the default latency buckets in seconds.
+var DefBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Histogram counts observations into fixed buckets, safe for concurrent use.
+type Histogram struct {
+	upperBounds []float64
+	counts      []uint64 // counts[i] 为落在第 i 个桶的次数, 最后一个为 +Inf 桶
+	count       uint64
+	sumBits     uint64 // float64 的总和, 以 bits 形式原子更新
+}
+
+// HistogramSnapshot is a point-in-time copy of a Histogram with
+// cumulative bucket counts, as the Prometheus format expects.
+type HistogramSnapshot struct {
+	UpperBounds []float64
+	Cumulative  []uint64 // 与 UpperBounds 一一对应, 不含 +Inf 桶
+	Count       uint64
+	Sum         float64
+}
+
+// NewHistogram creates a Histogram with the given bucket upper bounds.
+func NewHistogram(upperBounds []float64) *Histogram {
+	bounds := append([]float64(nil), upperBounds...)
+	sort.Float64s(bounds)
+	return &Histogram{
+		upperBounds: bounds,
+		counts:      make([]uint64, len(bounds)+1),
+	}
+}
+
+// Observe adds a single observation.
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.upperBounds, v)
+	atomic.AddUint64(&h.counts[i], 1)
+	atomic.AddUint64(&h.count, 1)
+	for {
+		old := atomic.LoadUint64(&h.sumBits)
+		sum := math.Float64bits(math.Float64frombits(old) + v)
+		if atomic.CompareAndSwapUint64(&h.sumBits, old, sum) {
+			return
+		}
+	}
+}
+
+// Snapshot returns the current state of the Histogram.
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	s := HistogramSnapshot{
+		UpperBounds: h.upperBounds,
+		Cumulative:  make([]uint64, len(h.upperBounds)),
+		Count:       atomic.LoadUint64(&h.count),
+		Sum:         math.Float64frombits(atomic.LoadUint64(&h.sumBits)),
+	}
+	var cumulative uint64
+	for i := range h.upperBounds {
+		cumulative += atomic.LoadUint64(&h.counts[i])
+		s.Cumulative[i] = cumulative
+	}
+	return s
+}
@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram([]float64{1, 0.1})
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(2)
+
+	s := h.Snapshot()
+	if s.Count != 3 || s.Sum != 2.55 {
+		t.Fatalf("unexpected count %d sum %v", s.Count, s.Sum)
+	}
+	if s.Cumulative[0] != 1 || s.Cumulative[1] != 2 {
+		t.Fatalf("unexpected cumulative buckets %v", s.Cumulative)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var b strings.Builder
+	w := NewWriter(&b)
+	w.Family("jie_cache_gets_total", "Total gets.", Counter)
+	w.Sample("jie_cache_gets_total", 3, "group", `sco"res`)
+	h := NewHistogram([]float64{0.1})
+	h.Observe(0.05)
+	w.Family("latency_seconds", "Latency.", Hist)
+	w.Histogram("latency_seconds", h.Snapshot(), "peer", "a")
+
+	expect := `# HELP jie_cache_gets_total Total gets.
+# TYPE jie_cache_gets_total counter
+jie_cache_gets_total{group="sco\"res"} 3
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{peer="a",le="0.1"} 1
+latency_seconds_bucket{peer="a",le="+Inf"} 1
+latency_seconds_sum{peer="a"} 0.05
+latency_seconds_count{peer="a"} 1
+`
+	if w.Err() != nil || b.String() != expect {
+		t.Fatalf("unexpected output:\n%s", b.String())
+	}
+}
@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ContentType is the content type of the Prometheus text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Metric types of the text exposition format.
+const (
+	Counter = "counter"
+	Gauge   = "gauge"
+	Hist    = "histogram"
+)
+
+// Writer writes metrics in the Prometheus text exposition format.
+// All samples of a metric family must be written right after its Family call.
+type Writer struct {
+	w   io.Writer
+	err error
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Err returns the first error that occurred while writing.
+func (w *Writer) Err() error {
+	return w.err
+}
+
+// Family writes the HELP and TYPE lines of a metric family.
+func (w *Writer) Family(name, help, typ string) {
+	w.printf("# HELP %s %s\n", name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help))
+	w.printf("# TYPE %s %s\n", name, typ)
+}
+
+// Sample writes one sample, labels are given as name, value pairs.
+func (w *Writer) Sample(name string, value float64, labels ...string) {
+	w.printf("%s%s %s\n", name, formatLabels(labels), formatFloat(value))
+}
+
+// Histogram writes the bucket, sum and count samples of a histogram.
+func (w *Writer) Histogram(name string, s HistogramSnapshot, labels ...string) {
+	for i, bound := range s.UpperBounds {
+		w.Sample(name+"_bucket", float64(s.Cumulative[i]), append(labels[:len(labels):len(labels)], "le", formatFloat(bound))...)
+	}
+	w.Sample(name+"_bucket", float64(s.Count), append(labels[:len(labels):len(labels)], "le", "+Inf")...)
+	w.Sample(name+"_sum", s.Sum, labels...)
+	w.Sample(name+"_count", float64(s.Count), labels...)
+}
+
+func (w *Writer) printf(format string, args ...interface{}) {
+	if w.err != nil {
+		return
+	}
+	_, w.err = fmt.Fprintf(w.w, format, args...)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(labels[i])
+		b.WriteString(`="`)
+		b.WriteString(labelValueEscaper.Replace(labels[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
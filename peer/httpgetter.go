@@ -1,41 +1,89 @@
 package peer
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"google.golang.org/protobuf/proto"
 	"io"
+	"jie_cache/guard"
 	"jie_cache/pb"
+	"jie_cache/retry"
 	"log"
 	"net/http"
 	"net/url"
+	"strconv"
+	"time"
 )
 
+// TimeoutHeader 携带调用方剩余的超时时间(毫秒)，远程节点据此设置自己的截止时间
+const TimeoutHeader = "X-Jie-Cache-Timeout"
+
 type HttpGetter struct {
 	baseUrl string
+	retry   *retry.Policy // Get 和 GetMulti 失败时的重试策略, 为 nil 时不重试
+}
+
+type Option func(h *HttpGetter)
+
+// Retry 设置 Get 和 GetMulti 失败时的重试策略，远程节点返回 4xx 时不重试，
+// 每次尝试单独计入请求延迟和错误数
+func Retry(policy *retry.Policy) Option {
+	return func(h *HttpGetter) {
+		h.retry = policy
+	}
 }
 
-func NewHttpGetter(host string) *HttpGetter {
-	return &HttpGetter{baseUrl: host}
+func NewHttpGetter(host string, opts ...Option) *HttpGetter {
+	h := &HttpGetter{baseUrl: host}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
-func (h *HttpGetter) Get(req *pb.Request, resp *pb.Response) error {
+func (h *HttpGetter) buildUrl(req *pb.Request) (string, error) {
 	u, err := url.Parse("http://" + h.baseUrl)
 	if err != nil {
-		log.Fatal(err)
+		return "", err
 	}
 	q := u.Query()
 	q.Set(`group`, req.Group)
 	q.Set(`key`, req.Key)
 	u.RawQuery = q.Encode()
-	log.Printf("[HttpGetter] url: %s \n", u.String())
-	res, err := http.Get(u.String())
+	return u.String(), nil
+}
+
+func (h *HttpGetter) Get(ctx context.Context, req *pb.Request, resp *pb.Response) error {
+	return h.retry.Do(ctx, func(ctx context.Context) error {
+		return h.get(ctx, req, resp)
+	})
+}
+
+func (h *HttpGetter) get(ctx context.Context, req *pb.Request, resp *pb.Response) (err error) {
+	defer func(start time.Time) {
+		observe(h.baseUrl, "get", start, err)
+	}(time.Now())
+	u, err := h.buildUrl(req)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("[HttpGetter] url: %s \n", u)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	if err := setTimeout(ctx, httpReq); err != nil {
+		return err
+	}
+	res, err := http.DefaultClient.Do(httpReq)
 	if err != nil {
 		return err
 	}
 	defer res.Body.Close()
 
 	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("server returned: %v", res.Status)
+		return statusError(res)
 	}
 
 	bytes, err := io.ReadAll(res.Body)
@@ -50,4 +98,135 @@ func (h *HttpGetter) Get(req *pb.Request, resp *pb.Response) error {
 	return nil
 }
 
+// GetMulti 把多个 key 放在一个请求中发送给远程节点
+func (h *HttpGetter) GetMulti(ctx context.Context, req *pb.BatchRequest, resp *pb.BatchResponse) error {
+	return h.retry.Do(ctx, func(ctx context.Context) error {
+		return h.getMulti(ctx, req, resp)
+	})
+}
+
+func (h *HttpGetter) getMulti(ctx context.Context, req *pb.BatchRequest, resp *pb.BatchResponse) (err error) {
+	defer func(start time.Time) {
+		observe(h.baseUrl, "get_multi", start, err)
+	}(time.Now())
+	u, err := url.Parse("http://" + h.baseUrl + "/batch")
+	if err != nil {
+		return err
+	}
+	body, err := proto.Marshal(req)
+	if err != nil {
+		return err
+	}
+	log.Printf("[HttpGetter] batch url: %s, keys: %d \n", u.String(), len(req.Keys))
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/octet-stream")
+	if err := setTimeout(ctx, httpReq); err != nil {
+		return err
+	}
+	res, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return statusError(res)
+	}
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("reading response body: %v", err)
+	}
+	return proto.Unmarshal(data, resp)
+}
+
+// statusError 把远程节点返回的错误状态转换为 error，除 429 以外的 4xx 重试也不会成功。
+// 远程节点的 Guard 拒绝调用时返回的错误包装对应的拒绝错误，同样不重试
+func statusError(res *http.Response) error {
+	err := fmt.Errorf("server returned: %v", res.Status)
+	if res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusServiceUnavailable {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 256))
+		if rejected := guard.ParseRejected(string(body)); rejected != nil {
+			// 远程节点正在保护自己的数据源，重试只会增加压力
+			return retry.Permanent(fmt.Errorf("%w: %w", err, rejected))
+		}
+	}
+	if res.StatusCode >= 400 && res.StatusCode < 500 && res.StatusCode != http.StatusTooManyRequests {
+		return retry.Permanent(err)
+	}
+	return err
+}
+
+// setTimeout 把 ctx 剩余的超时时间写入请求头
+func setTimeout(ctx context.Context, httpReq *http.Request) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout := time.Until(deadline).Milliseconds()
+		if timeout <= 0 {
+			return context.DeadlineExceeded
+		}
+		httpReq.Header.Set(TimeoutHeader, strconv.FormatInt(timeout, 10))
+	}
+	return nil
+}
+
+// Remove 通知远程节点删除 key，ctx 取消时中止请求
+func (h *HttpGetter) Remove(ctx context.Context, req *pb.Request) (err error) {
+	defer func(start time.Time) {
+		observe(h.baseUrl, "remove", start, err)
+	}(time.Now())
+	u, err := h.buildUrl(req)
+	if err != nil {
+		return err
+	}
+	log.Printf("[HttpGetter] remove url: %s \n", u)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodDelete, u, nil)
+	if err != nil {
+		return err
+	}
+	res, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned: %v", res.Status)
+	}
+	return nil
+}
+
+// Set 把 key 的新值发送给远程节点，ctx 取消时中止请求
+func (h *HttpGetter) Set(ctx context.Context, req *pb.SetRequest) (err error) {
+	defer func(start time.Time) {
+		observe(h.baseUrl, "set", start, err)
+	}(time.Now())
+	u, err := url.Parse("http://" + h.baseUrl)
+	if err != nil {
+		return err
+	}
+	body, err := proto.Marshal(req)
+	if err != nil {
+		return err
+	}
+	log.Printf("[HttpGetter] set url: %s \n", u.String())
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/octet-stream")
+	res, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned: %v", res.Status)
+	}
+	return nil
+}
+
 var _ PeerGetter = (*HttpGetter)(nil)
@@ -1,16 +1,136 @@
 package peer
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"google.golang.org/protobuf/proto"
+	"jie_cache/guard"
+	"jie_cache/pb"
+	"jie_cache/retry"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewHttpGetter(t *testing.T) {
-	getter := NewHttpGetter("http://localhost:8080/jie_cache")
-	val, err := getter.Get("school", "Jack")
+	getter := NewHttpGetter("localhost:8080/jie_cache")
+	resp := &pb.Response{}
+	err := getter.Get(context.Background(), &pb.Request{Group: "school", Key: "Jack"}, resp)
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
-	fmt.Println(string(val))
+	fmt.Println(string(resp.Value))
+}
+
+func TestHttpGetterRemove(t *testing.T) {
+	getter := NewHttpGetter("localhost:8080/jie_cache")
+	if err := getter.Remove(context.Background(), &pb.Request{Group: "school", Key: "Jack"}); err != nil {
+		fmt.Println(err)
+	}
+}
+
+func TestHttpGetterDeadline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(TimeoutHeader) == "" {
+			t.Error("timeout header should be set")
+		}
+		body, _ := proto.Marshal(&pb.Response{Value: []byte("589")})
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	getter := NewHttpGetter(strings.TrimPrefix(server.URL, "http://"))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp := &pb.Response{}
+	if err := getter.Get(ctx, &pb.Request{Group: "school", Key: "Jack"}, resp); err != nil || string(resp.Value) != "589" {
+		t.Fatalf("get Jack failed: %v", err)
+	}
+}
+
+func TestHttpGetterCancel(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	getter := NewHttpGetter(strings.TrimPrefix(server.URL, "http://"))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := getter.Get(ctx, &pb.Request{Group: "school", Key: "Jack"}, &pb.Response{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("get should be aborted by the context, got %v", err)
+	}
+	if err := getter.Remove(ctx, &pb.Request{Group: "school", Key: "Jack"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("remove should be aborted by the context, got %v", err)
+	}
+	if err := getter.Set(ctx, &pb.SetRequest{Group: "school", Key: "Jack", Value: []byte("600")}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("set should be aborted by the context, got %v", err)
+	}
+}
+
+func TestHttpGetterRetry(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch {
+		case r.URL.Query().Get("key") == "Bad":
+			w.WriteHeader(http.StatusBadRequest)
+		case calls < 3:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			body, _ := proto.Marshal(&pb.Response{Value: []byte("589")})
+			w.Write(body)
+		}
+	}))
+	defer server.Close()
+
+	policy := retry.New(retry.MaxAttempts(3), retry.Backoff(time.Millisecond, time.Millisecond))
+	getter := NewHttpGetter(strings.TrimPrefix(server.URL, "http://"), Retry(policy))
+	resp := &pb.Response{}
+	if err := getter.Get(context.Background(), &pb.Request{Group: "school", Key: "Jack"}, resp); err != nil || string(resp.Value) != "589" {
+		t.Fatalf("get Jack should succeed after retries: %v", err)
+	}
+	if calls != 3 {
+		t.Fatalf("expect 3 attempts, got %d", calls)
+	}
+
+	// 4xx 不重试
+	calls = 0
+	err := getter.Get(context.Background(), &pb.Request{Group: "school", Key: "Bad"}, &pb.Response{})
+	if err == nil || calls != 1 {
+		t.Fatalf("bad request should not be retried, calls %d err %v", calls, err)
+	}
+}
+
+func TestHttpGetterRejected(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch r.URL.Query().Get("key") {
+		case "Tom":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(guard.ErrCircuitOpen.Error()))
+		default:
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(guard.ErrRateLimited.Error()))
+		}
+	}))
+	defer server.Close()
+
+	// 远程节点的 Guard 拒绝调用时还原为对应的错误，并且不重试
+	policy := retry.New(retry.MaxAttempts(3), retry.Backoff(time.Millisecond, time.Millisecond))
+	getter := NewHttpGetter(strings.TrimPrefix(server.URL, "http://"), Retry(policy))
+	for key, expect := range map[string]error{"Tom": guard.ErrCircuitOpen, "Jack": guard.ErrRateLimited} {
+		calls = 0
+		err := getter.Get(context.Background(), &pb.Request{Group: "school", Key: key}, &pb.Response{})
+		if !errors.Is(err, expect) || calls != 1 {
+			t.Fatalf("%s: expect %v without retry, got %v after %d calls", key, expect, err, calls)
+		}
+	}
 }
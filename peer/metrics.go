@@ -0,0 +1,75 @@
+package peer
+
+import (
+	"jie_cache/metrics"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type transportKey struct {
+	peer   string
+	method string
+}
+
+type transportMetrics struct {
+	latency *metrics.Histogram
+	errors  int64
+}
+
+var (
+	transportMu sync.RWMutex
+	transport   = make(map[transportKey]*transportMetrics)
+)
+
+// TransportMetric is a snapshot of the requests sent to a peer with one method.
+type TransportMetric struct {
+	Peer    string
+	Method  string
+	Latency metrics.HistogramSnapshot // 请求延迟, 单位秒
+	Errors  int64
+}
+
+// observe 记录一次请求的延迟，以及是否失败
+func observe(peer, method string, start time.Time, err error) {
+	key := transportKey{peer: peer, method: method}
+	transportMu.RLock()
+	m, ok := transport[key]
+	transportMu.RUnlock()
+	if !ok {
+		transportMu.Lock()
+		if m, ok = transport[key]; !ok {
+			m = &transportMetrics{latency: metrics.NewHistogram(metrics.DefBuckets)}
+			transport[key] = m
+		}
+		transportMu.Unlock()
+	}
+	m.latency.Observe(time.Since(start).Seconds())
+	if err != nil {
+		atomic.AddInt64(&m.errors, 1)
+	}
+}
+
+// TransportMetrics returns the metrics of all requests sent to peers,
+// sorted by peer and method.
+func TransportMetrics() []TransportMetric {
+	transportMu.RLock()
+	result := make([]TransportMetric, 0, len(transport))
+	for key, m := range transport {
+		result = append(result, TransportMetric{
+			Peer:    key.peer,
+			Method:  key.method,
+			Latency: m.latency.Snapshot(),
+			Errors:  atomic.LoadInt64(&m.errors),
+		})
+	}
+	transportMu.RUnlock()
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Peer != result[j].Peer {
+			return result[i].Peer < result[j].Peer
+		}
+		return result[i].Method < result[j].Method
+	})
+	return result
+}
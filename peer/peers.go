@@ -1,14 +1,26 @@
 package peer
 
-import "jie_cache/pb"
+import (
+	"context"
+	"jie_cache/pb"
+)
 
 // PeerPicker is the interface that must be implemented to locate
 // the peer that owns a specific key.
 type PeerPicker interface {
 	PickPeer(key string) (peer PeerGetter, ok bool)
+	// GetAll returns all remote peers, used to broadcast invalidations.
+	GetAll() []PeerGetter
 }
 
 // PeerGetter is the interface that must be implemented by a peer.
 type PeerGetter interface {
-	Get(req *pb.Request, resp *pb.Response) error
+	// Get 在 ctx 取消时中止请求，并把 ctx 的截止时间传递给远程节点
+	Get(ctx context.Context, req *pb.Request, resp *pb.Response) error
+	// GetMulti 一次请求获取远程节点上的多个 key
+	GetMulti(ctx context.Context, req *pb.BatchRequest, resp *pb.BatchResponse) error
+	// Remove 在 ctx 取消时中止删除请求
+	Remove(ctx context.Context, req *pb.Request) error
+	// Set 在 ctx 取消时中止更新请求
+	Set(ctx context.Context, req *pb.SetRequest) error
 }
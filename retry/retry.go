@@ -0,0 +1,147 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+const (
+	DEFAULT_MAX_ATTEMPTS    = 3
+	DEFAULT_INITIAL_BACKOFF = 10 * time.Millisecond
+	DEFAULT_MAX_BACKOFF     = time.Second
+)
+
+// Policy 描述失败后如何重试：最多尝试 maxAttempts 次，第 n 次重试前等待
+// initial*2^(n-1)，不超过 maxBackoff，并在 ±jitter 的比例内随机浮动
+type Policy struct {
+	maxAttempts int
+	initial     time.Duration
+	maxBackoff  time.Duration
+	jitter      float64
+	retryable   func(err error) bool
+}
+
+type Option func(p *Policy)
+
+// MaxAttempts 设置最多尝试的次数，包括第一次调用
+func MaxAttempts(n int) Option {
+	return func(p *Policy) {
+		if n < 1 {
+			panic("max attempts must be positive")
+		}
+		p.maxAttempts = n
+	}
+}
+
+// Backoff 设置第一次重试前的等待时间和等待时间的上限，之后每次重试等待时间翻倍
+func Backoff(initial, maxBackoff time.Duration) Option {
+	return func(p *Policy) {
+		if initial <= 0 || maxBackoff < initial {
+			panic("backoff must be positive and max must not be less than initial")
+		}
+		p.initial = initial
+		p.maxBackoff = maxBackoff
+	}
+}
+
+// Jitter 让等待时间在 ±fraction 的范围内随机浮动，避免大量调用方同时重试
+func Jitter(fraction float64) Option {
+	return func(p *Policy) {
+		if fraction < 0 || fraction >= 1 {
+			panic("jitter fraction must be in [0, 1)")
+		}
+		p.jitter = fraction
+	}
+}
+
+// RetryIf 设置判断错误是否可以重试的函数，默认除了 ctx 结束和 Permanent 包装的错误都会重试。
+// Permanent 包装的错误总是不会重试
+func RetryIf(retryable func(err error) bool) Option {
+	return func(p *Policy) {
+		p.retryable = retryable
+	}
+}
+
+func New(opts ...Option) *Policy {
+	p := &Policy{
+		maxAttempts: DEFAULT_MAX_ATTEMPTS,
+		initial:     DEFAULT_INITIAL_BACKOFF,
+		maxBackoff:  DEFAULT_MAX_BACKOFF,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// permanentError 包装不可重试的错误
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent 把 err 标记为不可重试，Do 返回时会去掉这层包装
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err}
+}
+
+// Do 调用 fn，失败且错误可以重试时等待一段时间后再次调用，返回最后一次调用的错误。
+// ctx 结束或剩余时间不足以等待下一次重试时不再重试；p 为 nil 时只调用一次
+func (p *Policy) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			return permanent.err
+		}
+		if p == nil || attempt >= p.maxAttempts || !p.shouldRetry(err) {
+			return err
+		}
+		wait := p.backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= wait {
+			return err
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
+
+func (p *Policy) shouldRetry(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	return p.retryable == nil || p.retryable(err)
+}
+
+// backoff 返回第 attempt 次调用失败后的等待时间
+func (p *Policy) backoff(attempt int) time.Duration {
+	wait := p.initial
+	for i := 1; i < attempt && wait < p.maxBackoff; i++ {
+		wait *= 2
+	}
+	wait = min(wait, p.maxBackoff)
+	if p.jitter > 0 {
+		wait += time.Duration((rand.Float64()*2 - 1) * p.jitter * float64(wait))
+	}
+	return wait
+}
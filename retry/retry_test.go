@@ -0,0 +1,100 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errTransient = errors.New("transient")
+
+func TestDo(t *testing.T) {
+	p := New(MaxAttempts(3), Backoff(time.Millisecond, 4*time.Millisecond))
+	calls := 0
+	err := p.Do(context.Background(), func(context.Context) error {
+		calls++
+		if calls < 3 {
+			return errTransient
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Fatalf("should succeed on the third attempt, calls %d err %v", calls, err)
+	}
+
+	calls = 0
+	err = p.Do(context.Background(), func(context.Context) error {
+		calls++
+		return errTransient
+	})
+	if !errors.Is(err, errTransient) || calls != 3 {
+		t.Fatalf("should give up after 3 attempts, calls %d err %v", calls, err)
+	}
+}
+
+func TestNotRetryable(t *testing.T) {
+	errFatal := errors.New("fatal")
+	p := New(Backoff(time.Millisecond, time.Millisecond), RetryIf(func(err error) bool {
+		return !errors.Is(err, errFatal)
+	}))
+	for _, e := range []error{errFatal, Permanent(errTransient), context.Canceled} {
+		calls := 0
+		err := p.Do(context.Background(), func(context.Context) error {
+			calls++
+			return e
+		})
+		if calls != 1 {
+			t.Fatalf("%v should not be retried, calls %d", e, calls)
+		}
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			t.Fatal("Do should unwrap permanent errors")
+		}
+	}
+
+	// nil Policy 只调用一次
+	var nilPolicy *Policy
+	calls := 0
+	nilPolicy.Do(context.Background(), func(context.Context) error {
+		calls++
+		return errTransient
+	})
+	if calls != 1 {
+		t.Fatalf("nil policy should not retry, calls %d", calls)
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	p := New(MaxAttempts(10), Backoff(50*time.Millisecond, time.Second))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	calls := 0
+	start := time.Now()
+	err := p.Do(ctx, func(context.Context) error {
+		calls++
+		return errTransient
+	})
+	if !errors.Is(err, errTransient) || calls != 1 {
+		t.Fatalf("no time left for a retry, calls %d err %v", calls, err)
+	}
+	if time.Since(start) > 10*time.Millisecond {
+		t.Fatal("should not wait for a backoff past the deadline")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := New(Backoff(10*time.Millisecond, 50*time.Millisecond))
+	expect := []time.Duration{10, 20, 40, 50, 50}
+	for i, e := range expect {
+		if got := p.backoff(i + 1); got != e*time.Millisecond {
+			t.Fatalf("backoff %d expect %v, got %v", i+1, e*time.Millisecond, got)
+		}
+	}
+	p = New(Backoff(10*time.Millisecond, time.Second), Jitter(0.5))
+	for i := 0; i < 100; i++ {
+		if got := p.backoff(1); got < 5*time.Millisecond || got > 15*time.Millisecond {
+			t.Fatalf("jittered backoff %v out of range", got)
+		}
+	}
+}
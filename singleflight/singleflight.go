@@ -1,16 +1,21 @@
 package singleflight
 
-import "sync"
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
 
 type call struct {
-	wg  sync.WaitGroup
-	val interface{}
-	err error
+	done chan struct{} // 加载完成后关闭
+	val  interface{}
+	err  error
 }
 
 type Group struct {
-	mu sync.Mutex
-	m  map[string]*call
+	mu   sync.Mutex
+	m    map[string]*call
+	dups int64 // 等待已有调用结果、没有重复执行 fn 的次数
 }
 
 func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
@@ -20,20 +25,134 @@ func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, err
 	}
 	if c, ok := g.m[key]; ok {
 		g.mu.Unlock()
-		c.wg.Wait()
+		atomic.AddInt64(&g.dups, 1)
+		<-c.done
 		return c.val, c.err
 	}
-	c := new(call)
-	c.wg.Add(1)
+	c := &call{done: make(chan struct{})}
 	g.m[key] = c
 	g.mu.Unlock()
 
+	g.doCall(c, key, fn)
+	return c.val, c.err
+}
+
+// DoContext 与 Do 相同，但调用方可以在 ctx 结束时提前返回 ctx.Err()。
+// 加载在独立的 goroutine 中进行，任何调用方放弃等待都不会取消它；
+// fn 收到的 ctx 保留第一个调用方的值和截止时间，但不会随调用方一起取消
+func (g *Group) DoContext(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	c, ok := g.m[key]
+	if !ok {
+		c = &call{done: make(chan struct{})}
+		g.m[key] = c
+		loadCtx, cancel := detach(ctx)
+		go func() {
+			defer cancel()
+			g.doCall(c, key, func() (interface{}, error) {
+				return fn(loadCtx)
+			})
+		}()
+	} else {
+		atomic.AddInt64(&g.dups, 1)
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.val, c.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// DoMulti 与对每个 key 调用 DoContext 相同，但是没有进行中调用的 key 合并为一次 fn 调用，
+// 已经有进行中调用的 key 等待已有调用的结果。fn 必须为收到的每个 key 返回一个结果或者一个错误
+func (g *Group) DoMulti(ctx context.Context, keys []string, fn func(ctx context.Context, keys []string) (map[string]interface{}, map[string]error)) (map[string]interface{}, map[string]error) {
+	calls := make(map[string]*call, len(keys))
+	var owned []string
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	for _, key := range keys {
+		if _, ok := calls[key]; ok {
+			continue
+		}
+		c, ok := g.m[key]
+		if ok {
+			atomic.AddInt64(&g.dups, 1)
+		} else {
+			c = &call{done: make(chan struct{})}
+			g.m[key] = c
+			owned = append(owned, key)
+		}
+		calls[key] = c
+	}
+	g.mu.Unlock()
+
+	if len(owned) > 0 {
+		loadCtx, cancel := detach(ctx)
+		go func() {
+			defer cancel()
+			vals, errs := fn(loadCtx, owned)
+			g.mu.Lock()
+			defer g.mu.Unlock()
+			for _, key := range owned {
+				c := calls[key]
+				c.val, c.err = vals[key], errs[key]
+				close(c.done)
+				delete(g.m, key)
+			}
+		}()
+	}
+
+	vals := make(map[string]interface{}, len(calls))
+	errs := make(map[string]error)
+	for key, c := range calls {
+		select {
+		case <-c.done:
+			if c.err != nil {
+				errs[key] = c.err
+			} else {
+				vals[key] = c.val
+			}
+		case <-ctx.Done():
+			errs[key] = ctx.Err()
+		}
+	}
+	return vals, errs
+}
+
+// detach 返回保留 ctx 的值和截止时间、但不会随 ctx 一起取消的 ctx
+func detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	loadCtx := context.WithoutCancel(ctx)
+	if deadline, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(loadCtx, deadline)
+	}
+	return loadCtx, func() {}
+}
+
+func (g *Group) doCall(c *call, key string, fn func() (interface{}, error)) {
 	c.val, c.err = fn()
-	c.wg.Done()
+	close(c.done)
 
 	g.mu.Lock()
 	delete(g.m, key)
 	g.mu.Unlock()
+}
 
-	return c.val, c.err
+// Dups 返回被合并掉的重复调用次数
+func (g *Group) Dups() int64 {
+	return atomic.LoadInt64(&g.dups)
+}
+
+// InFlight 返回正在进行中的调用数量
+func (g *Group) InFlight() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.m)
 }
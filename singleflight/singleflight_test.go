@@ -0,0 +1,110 @@
+package singleflight
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDo(t *testing.T) {
+	var g Group
+	v, err := g.Do("key", func() (interface{}, error) {
+		return "bar", nil
+	})
+	if v.(string) != "bar" || err != nil {
+		t.Fatalf("Do v = %v, error = %v", v, err)
+	}
+}
+
+func TestDoDedup(t *testing.T) {
+	var g Group
+	var calls int32
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.Do("key", func() (interface{}, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return "bar", nil
+			})
+		}()
+	}
+	// 等待其余调用方都加入正在进行的调用
+	for i := 0; i < 1000 && g.Dups() < 9; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	if calls != 1 || g.Dups() != 9 {
+		t.Fatalf("fn should be called once, got %d calls %d dups", calls, g.Dups())
+	}
+}
+
+func TestDoContextWaiterGiveUp(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	loaded := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := g.DoContext(ctx, "key", func(loadCtx context.Context) (interface{}, error) {
+		<-release
+		if loadCtx.Err() != nil {
+			t.Error("load should not be cancelled by the caller")
+		}
+		close(loaded)
+		return "bar", nil
+	})
+	if err != context.Canceled {
+		t.Fatalf("caller should give up with context.Canceled, got %v", err)
+	}
+
+	close(release)
+	<-loaded
+}
+
+func TestDoMulti(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go g.Do("a", func() (interface{}, error) {
+		close(started)
+		<-release
+		return "from Do", nil
+	})
+	<-started
+
+	// a 已经在加载中，只有 b 和 c 交给 fn
+	var batched []string
+	done := make(chan struct{})
+	var vals map[string]interface{}
+	var errs map[string]error
+	go func() {
+		defer close(done)
+		vals, errs = g.DoMulti(context.Background(), []string{"a", "b", "c", "b"}, func(_ context.Context, keys []string) (map[string]interface{}, map[string]error) {
+			batched = keys
+			return map[string]interface{}{"b": "bar"}, map[string]error{"c": errors.New("boom")}
+		})
+	}()
+	for i := 0; i < 1000 && g.Dups() < 1; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	<-done
+	if !reflect.DeepEqual(batched, []string{"b", "c"}) {
+		t.Fatalf("only keys without a call in flight should be batched, got %v", batched)
+	}
+	if vals["a"] != "from Do" || vals["b"] != "bar" || errs["c"] == nil || len(vals) != 2 || len(errs) != 1 {
+		t.Fatalf("unexpected results %v %v", vals, errs)
+	}
+	if g.InFlight() != 0 {
+		t.Fatalf("calls should be removed after loading, %d in flight", g.InFlight())
+	}
+}
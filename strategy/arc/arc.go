@@ -0,0 +1,218 @@
+package arc
+
+import (
+	"container/list"
+	"jie_cache/strategy"
+	"time"
+)
+
+// 一个 key 所在的链表
+const (
+	inT1 = iota // 最近只访问过一次的 key
+	inT2        // 最近访问过至少两次的 key
+	inB1        // 从 T1 淘汰的 key, 只保留 key 和大小
+	inB2        // 从 T2 淘汰的 key, 只保留 key 和大小
+)
+
+// Cache 是按字节计算容量的 ARC(Adaptive Replacement Cache)。
+// T1 保存新访问的 key, T2 保存重复访问的 key, B1 和 B2 记录它们最近淘汰的 key,
+// 命中 B1 说明 T1 太小, 命中 B2 说明 T2 太小, 以此动态调整 T1 的目标大小 p,
+// 扫描只会进入 T1, 不会冲掉 T2 中的热点数据
+type Cache struct {
+	maxBytes  int64 // 缓存的最大内存, 0代表没有限制
+	p         int64 // T1 的目标内存
+	bytes     [4]int64
+	lists     [4]*list.List
+	nodeMap   map[string]*list.Element
+	OnEvicted func(key string, value strategy.Value) // key被删除时的回调函数
+}
+
+type entry struct {
+	key    string
+	value  strategy.Value // 在 B1、B2 中为 nil
+	size   int64
+	expire time.Time // 过期时间, 零值代表永不过期
+	where  int
+}
+
+func init() {
+	strategy.Register("ARC", func(maxBytes int64, onEvicted func(string, strategy.Value)) strategy.BaseCache {
+		return New(maxBytes, onEvicted)
+	})
+}
+
+func New(maxBytes int64, onEvicted func(string, strategy.Value)) *Cache {
+	c := &Cache{
+		maxBytes:  maxBytes,
+		nodeMap:   make(map[string]*list.Element),
+		OnEvicted: onEvicted,
+	}
+	for i := range c.lists {
+		c.lists[i] = list.New()
+	}
+	return c
+}
+
+func (c *Cache) Get(key string) (strategy.Value, bool) {
+	node, ok := c.nodeMap[key]
+	if !ok {
+		return nil, false
+	}
+	kv := node.Value.(*entry)
+	if kv.where == inB1 || kv.where == inB2 {
+		return nil, false
+	}
+	// 惰性删除过期的 key
+	if strategy.Expired(kv.expire, time.Now()) {
+		c.evict(node)
+		return nil, false
+	}
+	c.moveTo(node, inT2)
+	return kv.value, true
+}
+
+func (c *Cache) Add(key string, value strategy.Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+func (c *Cache) AddWithExpire(key string, value strategy.Value, expire time.Time) {
+	size := int64(len(key)) + int64(value.Len())
+	ghostHitB2 := false
+	if node, ok := c.nodeMap[key]; ok {
+		kv := node.Value.(*entry)
+		switch kv.where {
+		case inB1:
+			// T1 淘汰得太早, 增大 T1 的目标内存
+			c.p = min(c.maxBytes, c.p+max(size, size*c.bytes[inB2]/max(c.bytes[inB1], 1)))
+		case inB2:
+			// T2 淘汰得太早, 减小 T1 的目标内存
+			c.p = max(0, c.p-max(size, size*c.bytes[inB1]/max(c.bytes[inB2], 1)))
+			ghostHitB2 = true
+		}
+		c.bytes[kv.where] += size - kv.size
+		kv.value, kv.size, kv.expire = value, size, expire
+		c.moveTo(node, inT2)
+	} else {
+		c.nodeMap[key] = c.lists[inT1].PushFront(&entry{key: key, value: value, size: size, expire: expire, where: inT1})
+		c.bytes[inT1] += size
+	}
+
+	if c.maxBytes == 0 {
+		return
+	}
+	for c.bytes[inT1]+c.bytes[inT2] > c.maxBytes {
+		c.replace(ghostHitB2)
+	}
+	// T1+B1 以及所有链表的总和分别不超过 c 和 2c
+	for c.bytes[inT1]+c.bytes[inB1] > c.maxBytes && c.lists[inB1].Len() > 0 {
+		c.removeNode(c.lists[inB1].Back())
+	}
+	for c.bytes[inT1]+c.bytes[inT2]+c.bytes[inB1]+c.bytes[inB2] > 2*c.maxBytes && c.lists[inB2].Len() > 0 {
+		c.removeNode(c.lists[inB2].Back())
+	}
+}
+
+// replace 根据目标内存 p 从 T1 或 T2 淘汰一个 key, 并把它记录到对应的 B1 或 B2
+func (c *Cache) replace(ghostHitB2 bool) {
+	from, to := inT2, inB2
+	t1 := c.bytes[inT1]
+	if c.lists[inT1].Len() > 0 && (t1 > c.p || (ghostHitB2 && t1 == c.p) || c.lists[inT2].Len() == 0) {
+		from, to = inT1, inB1
+	}
+	node := c.lists[from].Back()
+	kv := node.Value.(*entry)
+	value := kv.value
+	kv.value = nil
+	c.moveTo(node, to)
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, value)
+	}
+}
+
+// moveTo 把节点移动到 where 链表的头部
+func (c *Cache) moveTo(node *list.Element, where int) {
+	kv := node.Value.(*entry)
+	if kv.where == where {
+		c.lists[where].MoveToFront(node)
+		return
+	}
+	c.lists[kv.where].Remove(node)
+	c.bytes[kv.where] -= kv.size
+	kv.where = where
+	c.nodeMap[kv.key] = c.lists[where].PushFront(kv)
+	c.bytes[where] += kv.size
+}
+
+// Remove 删除指定的 key, 主动删除不会触发 OnEvicted
+func (c *Cache) Remove(key string) {
+	if node, ok := c.nodeMap[key]; ok {
+		c.removeNode(node)
+	}
+}
+
+// RemoveExpired 清理所有已过期的 key
+func (c *Cache) RemoveExpired() int {
+	now := time.Now()
+	removed := 0
+	for _, where := range []int{inT1, inT2} {
+		for node := c.lists[where].Back(); node != nil; {
+			prev := node.Prev()
+			if strategy.Expired(node.Value.(*entry).expire, now) {
+				c.evict(node)
+				removed++
+			}
+			node = prev
+		}
+	}
+	return removed
+}
+
+func (c *Cache) removeNode(node *list.Element) *entry {
+	kv := node.Value.(*entry)
+	c.lists[kv.where].Remove(node)
+	c.bytes[kv.where] -= kv.size
+	delete(c.nodeMap, kv.key)
+	return kv
+}
+
+// evict 删除节点并触发 OnEvicted
+func (c *Cache) evict(node *list.Element) {
+	kv := c.removeNode(node)
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+func (c *Cache) Len() int {
+	return c.lists[inT1].Len() + c.lists[inT2].Len()
+}
+
+func (c *Cache) Bytes() int64 {
+	return c.bytes[inT1] + c.bytes[inT2]
+}
+
+// Keys 返回所有未过期的 key, 先 T2 后 T1, 各自按从新到旧的顺序
+func (c *Cache) Keys() []string {
+	keys := make([]string, 0, c.Len())
+	c.Range(func(key string, _ strategy.Value) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// Range 遍历所有未过期的 key, 先 T2 后 T1, 各自按从新到旧的顺序
+func (c *Cache) Range(fn func(key string, value strategy.Value) bool) {
+	now := time.Now()
+	for _, where := range []int{inT2, inT1} {
+		for node := c.lists[where].Front(); node != nil; node = node.Next() {
+			kv := node.Value.(*entry)
+			if strategy.Expired(kv.expire, now) {
+				continue
+			}
+			if !fn(kv.key, kv.value) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package arc
+
+import (
+	"jie_cache/strategy"
+	"jie_cache/strategy/lfu"
+	"jie_cache/strategy/lru"
+	"jie_cache/strategy/strategytest"
+	"testing"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestGet(t *testing.T) {
+	arc := New(int64(0), nil)
+	arc.Add("key1", String("1234"))
+	if v, ok := arc.Get("key1"); !ok || string(v.(String)) != "1234" {
+		t.Fatal("cache hit key1=1234 failed")
+	}
+	if _, ok := arc.Get("key2"); ok {
+		t.Fatal("cache miss key2 failed")
+	}
+}
+
+func TestEvict(t *testing.T) {
+	var evicted []string
+	arc := New(int64(10), func(key string, _ strategy.Value) {
+		evicted = append(evicted, key)
+	})
+	arc.Add("k1", String("111"))
+	arc.Get("k1") // k1 进入 T2
+	arc.Add("k2", String("222"))
+	arc.Add("k3", String("333"))
+	if len(evicted) != 1 || evicted[0] != "k2" {
+		t.Fatalf("k2 in T1 should be evicted first, got %v", evicted)
+	}
+	if _, ok := arc.Get("k1"); !ok {
+		t.Fatal("frequently used k1 should stay")
+	}
+	if arc.Bytes() > 10 || arc.Len() != 2 {
+		t.Fatalf("unexpected len %d bytes %d", arc.Len(), arc.Bytes())
+	}
+
+	// k2 命中 B1, 增大 T1 的目标内存并直接进入 T2
+	arc.Add("k2", String("222"))
+	if arc.p == 0 {
+		t.Fatal("ghost hit in B1 should grow p")
+	}
+	if node := arc.nodeMap["k2"]; node.Value.(*entry).where != inT2 {
+		t.Fatal("ghost hit should insert into T2")
+	}
+}
+
+func TestRemoveAndExpire(t *testing.T) {
+	strategytest.RemoveAndExpire(t, New(0, nil))
+}
+
+func TestHitRatioOnScans(t *testing.T) {
+	trace := strategytest.ScanTrace()
+	// 热点 key 占用 8 字节，扫描的 key 占用 10 字节，容量放得下热点但放不下一次扫描
+	const maxBytes = 300
+	arcRatio := strategytest.HitRatio(New(maxBytes, nil), trace)
+	lruRatio := strategytest.HitRatio(lru.New(maxBytes, nil), trace)
+	lfuRatio := strategytest.HitRatio(lfu.New(maxBytes, nil), trace)
+	t.Logf("hit ratio arc %.3f lru %.3f lfu %.3f", arcRatio, lruRatio, lfuRatio)
+	if arcRatio <= lruRatio {
+		t.Fatalf("arc should beat lru on scans, arc %.3f lru %.3f", arcRatio, lruRatio)
+	}
+	if arcRatio <= lfuRatio {
+		t.Fatalf("arc should beat lfu after the hot set changes, arc %.3f lfu %.3f", arcRatio, lfuRatio)
+	}
+}
@@ -1,5 +1,7 @@
 package strategy
 
+import "time"
+
 type Value interface {
 	Len() int
 }
@@ -7,4 +9,36 @@ type Value interface {
 type BaseCache interface {
 	Get(key string) (Value, bool)
 	Add(key string, value Value)
+	// AddWithExpire 添加带过期时间的 key, expire 为零值表示永不过期
+	AddWithExpire(key string, value Value, expire time.Time)
+	Remove(key string)
+	// RemoveExpired 清理所有已过期的 key, 返回清理的数量
+	RemoveExpired() int
+	// Len 返回 key 的数量
+	Len() int
+	// Bytes 返回当前使用的内存
+	Bytes() int64
+	// Keys 返回所有未过期的 key
+	Keys() []string
+	// Range 遍历所有未过期的 key, fn 返回 false 时停止遍历;
+	// 遍历不会改变 key 的访问顺序和频率, fn 中不能修改缓存
+	Range(fn func(key string, value Value) bool)
+}
+
+// Expired 判断过期时间 expire 在 now 时是否已经过期, 零值表示永不过期
+func Expired(expire, now time.Time) bool {
+	return !expire.IsZero() && now.After(expire)
+}
+
+// ConcurrentGetter 由命中时只设置访问位或计数器的策略实现, 例如 CLOCK 和 S3-FIFO。
+// ConcurrentGet 只需要读锁, 可以和其他 ConcurrentGet 并发调用,
+// 它不会删除过期的 key, 过期的 key 留给 Add 淘汰或 RemoveExpired 清理
+type ConcurrentGetter interface {
+	ConcurrentGet(key string) (Value, bool)
+}
+
+// CostAdder 由按重新加载的代价淘汰的策略实现, 例如 GDSF。
+// cost 是重新加载 key 的代价, 例如从数据源加载的秒数, 代价越大越不容易被淘汰
+type CostAdder interface {
+	AddWithCost(key string, value Value, expire time.Time, cost float64)
 }
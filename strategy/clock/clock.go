@@ -0,0 +1,202 @@
+package clock
+
+import (
+	"container/list"
+	"jie_cache/strategy"
+	"sync/atomic"
+	"time"
+)
+
+// Cache 是按字节计算容量的 CLOCK 缓存。
+// 所有 key 组成一个环, 命中时只设置访问位, 不移动节点, 所以读操作只需要读锁;
+// 淘汰时指针沿环移动, 清除遇到的访问位, 淘汰第一个访问位为 0 的 key
+type Cache struct {
+	maxBytes  int64 // 缓存的最大内存, 0代表没有限制
+	nBytes    int64 // 当前使用的内存
+	ring      *list.List
+	hand      *list.Element // 下一个要检查的节点
+	nodeMap   map[string]*list.Element
+	OnEvicted func(key string, value strategy.Value) // key被删除时的回调函数
+}
+
+type entry struct {
+	key        string
+	value      strategy.Value
+	expire     time.Time   // 过期时间, 零值代表永不过期
+	referenced atomic.Bool // 访问位
+}
+
+func init() {
+	strategy.Register("CLOCK", func(maxBytes int64, onEvicted func(string, strategy.Value)) strategy.BaseCache {
+		return New(maxBytes, onEvicted)
+	})
+}
+
+func New(maxBytes int64, onEvicted func(string, strategy.Value)) *Cache {
+	return &Cache{
+		maxBytes:  maxBytes,
+		ring:      list.New(),
+		nodeMap:   make(map[string]*list.Element),
+		OnEvicted: onEvicted,
+	}
+}
+
+func (c *Cache) Get(key string) (strategy.Value, bool) {
+	node, ok := c.nodeMap[key]
+	if !ok {
+		return nil, false
+	}
+	kv := node.Value.(*entry)
+	// 惰性删除过期的 key
+	if strategy.Expired(kv.expire, time.Now()) {
+		c.evict(node)
+		return nil, false
+	}
+	kv.referenced.Store(true)
+	return kv.value, true
+}
+
+// ConcurrentGet 和 Get 相同, 但不删除过期的 key, 可以在读锁下并发调用
+func (c *Cache) ConcurrentGet(key string) (strategy.Value, bool) {
+	node, ok := c.nodeMap[key]
+	if !ok {
+		return nil, false
+	}
+	kv := node.Value.(*entry)
+	if strategy.Expired(kv.expire, time.Now()) {
+		return nil, false
+	}
+	// 已经设置过时不再写入, 避免多核之间争抢同一个缓存行
+	if !kv.referenced.Load() {
+		kv.referenced.Store(true)
+	}
+	return kv.value, true
+}
+
+func (c *Cache) Add(key string, value strategy.Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+func (c *Cache) AddWithExpire(key string, value strategy.Value, expire time.Time) {
+	if node, ok := c.nodeMap[key]; ok {
+		kv := node.Value.(*entry)
+		c.nBytes += int64(value.Len()) - int64(kv.value.Len())
+		kv.value = value
+		kv.expire = expire
+		kv.referenced.Store(true)
+	} else {
+		kv := &entry{key: key, value: value, expire: expire}
+		// 新节点放在指针之前, 也就是指针转一圈后最后检查的位置
+		if c.hand == nil {
+			c.nodeMap[key] = c.ring.PushBack(kv)
+		} else {
+			c.nodeMap[key] = c.ring.InsertBefore(kv, c.hand)
+		}
+		c.nBytes += int64(len(key)) + int64(value.Len())
+	}
+
+	for c.maxBytes != 0 && c.maxBytes < c.nBytes {
+		c.removeOldest()
+	}
+}
+
+// removeOldest 沿环移动指针, 淘汰第一个访问位为 0 的 key
+func (c *Cache) removeOldest() {
+	for c.ring.Len() > 0 {
+		if c.hand == nil {
+			c.hand = c.ring.Front()
+		}
+		node := c.hand
+		kv := node.Value.(*entry)
+		if kv.referenced.Load() {
+			kv.referenced.Store(false)
+			c.advance()
+			continue
+		}
+		c.evict(node)
+		return
+	}
+}
+
+// advance 把指针移动到下一个节点, 到达末尾时回到开头
+func (c *Cache) advance() {
+	c.hand = c.hand.Next()
+	if c.hand == nil {
+		c.hand = c.ring.Front()
+	}
+}
+
+// Remove 删除指定的 key, 主动删除不会触发 OnEvicted
+func (c *Cache) Remove(key string) {
+	if node, ok := c.nodeMap[key]; ok {
+		c.removeNode(node)
+	}
+}
+
+// RemoveExpired 清理所有已过期的 key
+func (c *Cache) RemoveExpired() int {
+	now := time.Now()
+	removed := 0
+	for node := c.ring.Front(); node != nil; {
+		next := node.Next()
+		if strategy.Expired(node.Value.(*entry).expire, now) {
+			c.evict(node)
+			removed++
+		}
+		node = next
+	}
+	return removed
+}
+
+func (c *Cache) removeNode(node *list.Element) *entry {
+	if c.hand == node {
+		c.advance()
+		if c.hand == node {
+			c.hand = nil
+		}
+	}
+	kv := c.ring.Remove(node).(*entry)
+	delete(c.nodeMap, kv.key)
+	c.nBytes -= int64(len(kv.key)) + int64(kv.value.Len())
+	return kv
+}
+
+// evict 删除节点并触发 OnEvicted
+func (c *Cache) evict(node *list.Element) {
+	kv := c.removeNode(node)
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+func (c *Cache) Len() int {
+	return c.ring.Len()
+}
+
+func (c *Cache) Bytes() int64 {
+	return c.nBytes
+}
+
+// Keys 按插入环的顺序返回所有未过期的 key
+func (c *Cache) Keys() []string {
+	keys := make([]string, 0, c.ring.Len())
+	c.Range(func(key string, _ strategy.Value) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// Range 按插入环的顺序遍历所有未过期的 key
+func (c *Cache) Range(fn func(key string, value strategy.Value) bool) {
+	now := time.Now()
+	for node := c.ring.Front(); node != nil; node = node.Next() {
+		kv := node.Value.(*entry)
+		if strategy.Expired(kv.expire, now) {
+			continue
+		}
+		if !fn(kv.key, kv.value) {
+			return
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package clock
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"jie_cache/strategy"
+	"jie_cache/strategy/strategytest"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestGet(t *testing.T) {
+	clock := New(int64(0), nil)
+	clock.Add("key1", String("1234"))
+	if v, ok := clock.Get("key1"); !ok || string(v.(String)) != "1234" {
+		t.Fatal("cache hit key1=1234 failed")
+	}
+	if _, ok := clock.Get("key2"); ok {
+		t.Fatal("cache miss key2 failed")
+	}
+}
+
+func TestEvict(t *testing.T) {
+	var evicted []string
+	clock := New(int64(12), func(key string, _ strategy.Value) {
+		evicted = append(evicted, key)
+	})
+	clock.Add("k1", String("11"))
+	clock.Add("k2", String("22"))
+	clock.Add("k3", String("33"))
+	clock.Get("k1") // k1 获得第二次机会
+	clock.Add("k4", String("44"))
+	if len(evicted) != 1 || evicted[0] != "k2" {
+		t.Fatalf("k2 should be evicted, got %v", evicted)
+	}
+	clock.Add("k5", String("55"))
+	if len(evicted) != 2 || evicted[1] != "k3" {
+		t.Fatalf("k3 should be evicted, got %v", evicted)
+	}
+	if _, ok := clock.Get("k1"); !ok {
+		t.Fatal("referenced k1 should stay")
+	}
+	if clock.Len() != 3 || clock.Bytes() != 12 {
+		t.Fatalf("unexpected len %d bytes %d", clock.Len(), clock.Bytes())
+	}
+}
+
+func TestRemoveAndExpire(t *testing.T) {
+	strategytest.RemoveAndExpire(t, New(0, nil))
+}
+
+func TestConcurrentGet(t *testing.T) {
+	clock := New(int64(0), nil)
+	for i := 0; i < 100; i++ {
+		clock.Add(strconv.Itoa(i), String("v"))
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				if _, ok := clock.ConcurrentGet(strconv.Itoa(i % 100)); !ok {
+					t.Error("concurrent get missed")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,222 @@
+package gdsf
+
+import (
+	"container/heap"
+	"jie_cache/strategy"
+	"time"
+)
+
+// Cache 是按字节计算容量的 GDSF(GreedyDual-Size-Frequency) 缓存。
+// 每个 key 的优先级为 L + freq*cost/size, 淘汰优先级最低的 key 并把 L 提高到它的优先级,
+// 所以小的、经常访问的、加载代价大的 key 更不容易被淘汰, 很久没有访问的 key 会随 L 的增长而被淘汰
+type Cache struct {
+	maxBytes  int64   // 缓存的最大内存, 0代表没有限制
+	nBytes    int64   // 当前使用的内存
+	clock     float64 // 即 L, 最近一次淘汰的 key 的优先级
+	totalCost float64 // 已知代价的总和, 用于估计未知代价
+	nCosts    int64
+	pq        priorityQueue
+	nodeMap   map[string]*entry
+	OnEvicted func(key string, value strategy.Value) // key被删除时的回调函数
+}
+
+type entry struct {
+	key      string
+	value    strategy.Value
+	size     int64
+	expire   time.Time // 过期时间, 零值代表永不过期
+	freq     float64
+	cost     float64
+	priority float64
+	index    int // 在堆中的位置
+}
+
+func init() {
+	strategy.Register("GDSF", func(maxBytes int64, onEvicted func(string, strategy.Value)) strategy.BaseCache {
+		return New(maxBytes, onEvicted)
+	})
+}
+
+func New(maxBytes int64, onEvicted func(string, strategy.Value)) *Cache {
+	return &Cache{
+		maxBytes:  maxBytes,
+		nodeMap:   make(map[string]*entry),
+		OnEvicted: onEvicted,
+	}
+}
+
+func (c *Cache) Get(key string) (strategy.Value, bool) {
+	kv, ok := c.nodeMap[key]
+	if !ok {
+		return nil, false
+	}
+	// 惰性删除过期的 key
+	if strategy.Expired(kv.expire, time.Now()) {
+		c.evict(kv)
+		return nil, false
+	}
+	kv.freq++
+	c.updatePriority(kv)
+	return kv.value, true
+}
+
+func (c *Cache) Add(key string, value strategy.Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// AddWithExpire 添加代价未知的 key, 已有的 key 保留原来的代价, 新 key 使用已知代价的平均值
+func (c *Cache) AddWithExpire(key string, value strategy.Value, expire time.Time) {
+	cost := c.averageCost()
+	if kv, ok := c.nodeMap[key]; ok {
+		cost = kv.cost
+	}
+	c.add(key, value, expire, cost)
+}
+
+// AddWithCost 添加 key, cost 是重新加载它的代价
+func (c *Cache) AddWithCost(key string, value strategy.Value, expire time.Time, cost float64) {
+	if cost <= 0 {
+		c.AddWithExpire(key, value, expire)
+		return
+	}
+	c.totalCost += cost
+	c.nCosts++
+	c.add(key, value, expire, cost)
+}
+
+func (c *Cache) add(key string, value strategy.Value, expire time.Time, cost float64) {
+	size := int64(len(key)) + int64(value.Len())
+	if kv, ok := c.nodeMap[key]; ok {
+		c.nBytes += size - kv.size
+		kv.value, kv.size, kv.expire, kv.cost = value, size, expire, cost
+		kv.freq++
+		c.updatePriority(kv)
+	} else {
+		kv := &entry{key: key, value: value, size: size, expire: expire, freq: 1, cost: cost}
+		kv.priority = c.priority(kv)
+		heap.Push(&c.pq, kv)
+		c.nodeMap[key] = kv
+		c.nBytes += size
+	}
+
+	for c.maxBytes != 0 && c.maxBytes < c.nBytes && c.pq.Len() > 0 {
+		c.removeOldest()
+	}
+}
+
+// averageCost 返回已知代价的平均值, 还没有已知代价时返回 1
+func (c *Cache) averageCost() float64 {
+	if c.nCosts == 0 {
+		return 1
+	}
+	return c.totalCost / float64(c.nCosts)
+}
+
+func (c *Cache) priority(kv *entry) float64 {
+	return c.clock + kv.freq*kv.cost/float64(max(kv.size, 1))
+}
+
+func (c *Cache) updatePriority(kv *entry) {
+	kv.priority = c.priority(kv)
+	heap.Fix(&c.pq, kv.index)
+}
+
+// removeOldest 淘汰优先级最低的 key, 并把 L 提高到它的优先级
+func (c *Cache) removeOldest() {
+	kv := c.pq[0]
+	c.clock = kv.priority
+	c.evict(kv)
+}
+
+// Remove 删除指定的 key, 主动删除不会触发 OnEvicted
+func (c *Cache) Remove(key string) {
+	if kv, ok := c.nodeMap[key]; ok {
+		c.removeNode(kv)
+	}
+}
+
+// RemoveExpired 清理所有已过期的 key
+func (c *Cache) RemoveExpired() int {
+	now := time.Now()
+	removed := 0
+	for _, kv := range c.nodeMap {
+		if strategy.Expired(kv.expire, now) {
+			c.evict(kv)
+			removed++
+		}
+	}
+	return removed
+}
+
+func (c *Cache) removeNode(kv *entry) {
+	heap.Remove(&c.pq, kv.index)
+	delete(c.nodeMap, kv.key)
+	c.nBytes -= kv.size
+}
+
+// evict 删除节点并触发 OnEvicted
+func (c *Cache) evict(kv *entry) {
+	c.removeNode(kv)
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+func (c *Cache) Len() int {
+	return len(c.nodeMap)
+}
+
+func (c *Cache) Bytes() int64 {
+	return c.nBytes
+}
+
+// Keys 返回所有未过期的 key, 顺序不确定
+func (c *Cache) Keys() []string {
+	keys := make([]string, 0, len(c.nodeMap))
+	c.Range(func(key string, _ strategy.Value) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// Range 遍历所有未过期的 key, 顺序不确定
+func (c *Cache) Range(fn func(key string, value strategy.Value) bool) {
+	now := time.Now()
+	for _, kv := range c.pq {
+		if strategy.Expired(kv.expire, now) {
+			continue
+		}
+		if !fn(kv.key, kv.value) {
+			return
+		}
+	}
+}
+
+// priorityQueue 是按优先级排列的最小堆
+type priorityQueue []*entry
+
+func (pq priorityQueue) Len() int { return len(pq) }
+
+func (pq priorityQueue) Less(i, j int) bool { return pq[i].priority < pq[j].priority }
+
+func (pq priorityQueue) Swap(i, j int) {
+	pq[i], pq[j] = pq[j], pq[i]
+	pq[i].index = i
+	pq[j].index = j
+}
+
+func (pq *priorityQueue) Push(x any) {
+	kv := x.(*entry)
+	kv.index = len(*pq)
+	*pq = append(*pq, kv)
+}
+
+func (pq *priorityQueue) Pop() any {
+	old := *pq
+	n := len(old)
+	kv := old[n-1]
+	old[n-1] = nil
+	*pq = old[:n-1]
+	return kv
+}
@@ -0,0 +1,73 @@
+package gdsf
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"jie_cache/strategy"
+	"jie_cache/strategy/strategytest"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestGet(t *testing.T) {
+	gdsf := New(int64(0), nil)
+	gdsf.Add("key1", String("1234"))
+	if v, ok := gdsf.Get("key1"); !ok || string(v.(String)) != "1234" {
+		t.Fatal("cache hit key1=1234 failed")
+	}
+	if _, ok := gdsf.Get("key2"); ok {
+		t.Fatal("cache miss key2 failed")
+	}
+}
+
+func TestCostAware(t *testing.T) {
+	var evicted []string
+	gdsf := New(int64(40), func(key string, _ strategy.Value) {
+		evicted = append(evicted, key)
+	})
+	// slow 加载要 2 秒, 其他 key 只要 1 毫秒
+	gdsf.AddWithCost("slow", String("123456"), time.Time{}, 2)
+	for i := 0; i < 20; i++ {
+		gdsf.AddWithCost(fmt.Sprintf("fast%02d", i), String("123"), time.Time{}, 0.001)
+	}
+	if _, ok := gdsf.Get("slow"); !ok {
+		t.Fatalf("expensive slow should stay, evicted %v", evicted)
+	}
+	if evicted[0] != "fast00" {
+		t.Fatalf("cheap keys should be evicted first, got %v", evicted)
+	}
+	if gdsf.Bytes() > 40 {
+		t.Fatalf("bytes %d exceed maxBytes", gdsf.Bytes())
+	}
+}
+
+func TestFrequencyAndSize(t *testing.T) {
+	gdsf := New(int64(33), nil)
+	gdsf.AddWithCost("big", String("1234567890"), time.Time{}, 1)
+	gdsf.AddWithCost("small", String("1"), time.Time{}, 1)
+	gdsf.AddWithCost("hot", String("1234567890"), time.Time{}, 1)
+	gdsf.Get("hot")
+	// 同样的代价下, 大的、访问少的 big 优先级最低
+	gdsf.AddWithCost("new", String("12"), time.Time{}, 1)
+	if _, ok := gdsf.nodeMap["big"]; ok {
+		t.Fatal("big should be evicted")
+	}
+	for _, key := range []string{"small", "hot", "new"} {
+		if _, ok := gdsf.nodeMap[key]; !ok {
+			t.Fatalf("%s should stay", key)
+		}
+	}
+	if gdsf.clock == 0 {
+		t.Fatal("eviction should inflate L")
+	}
+}
+
+func TestRemoveAndExpire(t *testing.T) {
+	strategytest.RemoveAndExpire(t, New(0, nil))
+}
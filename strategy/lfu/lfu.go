@@ -3,6 +3,8 @@ package lfu
 import (
 	"container/list"
 	"jie_cache/strategy"
+	"sort"
+	"time"
 )
 
 type Cache struct {
@@ -12,26 +14,77 @@ type Cache struct {
 	listMap   map[int]*list.List
 	nodeMap   map[string]*list.Element
 	OnEvicted func(key string, value strategy.Value) // key被删除时的回调函数
+
+	// 频率衰减, 让过去的热点可以被淘汰
+	halveEvery int           // 每 halveEvery 次访问把所有频率减半, 0代表不衰减
+	ops        int           // 上次减半后的访问次数
+	halfLife   time.Duration // 频率的半衰期, 0代表不衰减
+	lastDecay  time.Time     // 上次按时间衰减的时间
+	now        func() time.Time
+}
+
+// Option 配置 LFU 的频率衰减
+type Option func(c *Cache)
+
+// HalveEvery 每 n 次 Get 和 Add 把所有 key 的频率减半
+func HalveEvery(n int) Option {
+	return func(c *Cache) {
+		if n < 0 {
+			panic("halveEvery must not be negative")
+		}
+		c.halveEvery = n
+	}
+}
+
+// HalfLife 按时间对频率做指数衰减, 每经过 halfLife 所有 key 的频率减半
+func HalfLife(halfLife time.Duration) Option {
+	return func(c *Cache) {
+		if halfLife < 0 {
+			panic("halfLife must not be negative")
+		}
+		c.halfLife = halfLife
+	}
 }
 
 type entry struct {
-	key   string
-	value strategy.Value
-	freq  int
+	key    string
+	value  strategy.Value
+	freq   int
+	expire time.Time // 过期时间, 零值代表永不过期
+}
+
+func init() {
+	strategy.Register("LFU", func(maxBytes int64, onEvicted func(string, strategy.Value)) strategy.BaseCache {
+		return New(maxBytes, onEvicted)
+	})
 }
 
-func New(maxBytes int64, onEvicted func(key string, value strategy.Value)) *Cache {
-	return &Cache{
+func New(maxBytes int64, onEvicted func(key string, value strategy.Value), opts ...Option) *Cache {
+	c := &Cache{
 		maxBytes:  maxBytes,
 		listMap:   make(map[int]*list.List),
 		nodeMap:   make(map[string]*list.Element),
 		OnEvicted: onEvicted,
+		now:       time.Now,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.halfLife > 0 {
+		c.lastDecay = c.now()
+	}
+	return c
 }
 
 func (c *Cache) Get(key string) (strategy.Value, bool) {
+	c.decay()
 	if node, ok := c.nodeMap[key]; ok {
 		kv := node.Value.(*entry)
+		// 惰性删除过期的 key
+		if strategy.Expired(kv.expire, time.Now()) {
+			c.evict(node)
+			return nil, false
+		}
 		c.moveNodeToNextLevel(node)
 		return kv.value, true
 	}
@@ -46,19 +99,26 @@ func (c *Cache) getList(freq int) *list.List {
 }
 
 func (c *Cache) Add(key string, value strategy.Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+func (c *Cache) AddWithExpire(key string, value strategy.Value, expire time.Time) {
+	c.decay()
 	if node, ok := c.nodeMap[key]; ok {
 		kv := node.Value.(*entry)
 		c.nBytes += int64(value.Len()) - int64(kv.value.Len())
 		kv.value = value
+		kv.expire = expire
 		c.moveNodeToNextLevel(node)
 	} else {
 		ll := c.getList(1)
 		c.minFreq = 1
 		c.nBytes += int64(len(key)) + int64(value.Len())
 		c.nodeMap[key] = ll.PushFront(&entry{
-			key:   key,
-			value: value,
-			freq:  1,
+			key:    key,
+			value:  value,
+			freq:   1,
+			expire: expire,
 		})
 	}
 	for c.maxBytes != 0 && c.maxBytes < c.nBytes {
@@ -69,7 +129,7 @@ func (c *Cache) Add(key string, value strategy.Value) {
 func (c *Cache) moveNodeToNextLevel(node *list.Element) {
 	kv := node.Value.(*entry)
 	c.listMap[kv.freq].Remove(node)
-	if c.listMap[c.minFreq].Len() == 0 {
+	if kv.freq == c.minFreq && c.listMap[c.minFreq].Len() == 0 {
 		c.minFreq++
 	}
 	kv.freq++
@@ -77,6 +137,93 @@ func (c *Cache) moveNodeToNextLevel(node *list.Element) {
 	c.nodeMap[kv.key] = ll.PushFront(kv)
 }
 
+// decay 记录一次访问, 达到 halveEvery 次或经过 halfLife 时衰减所有 key 的频率
+func (c *Cache) decay() {
+	shift := 0
+	if c.halveEvery > 0 {
+		c.ops++
+		if c.ops >= c.halveEvery {
+			c.ops = 0
+			shift++
+		}
+	}
+	if c.halfLife > 0 {
+		now := c.now()
+		if elapsed := now.Sub(c.lastDecay); elapsed >= c.halfLife {
+			periods := elapsed / c.halfLife
+			c.lastDecay = c.lastDecay.Add(periods * c.halfLife)
+			shift += int(min(periods, 62))
+		}
+	}
+	if shift > 0 {
+		c.age(shift)
+	}
+}
+
+// age 把所有 key 的频率右移 shift 位, 最小为 1。
+// 合并到同一频率的 key 中, 原来频率高的排在前面, 原来频率相同的保持原有顺序
+func (c *Cache) age(shift int) {
+	freqs := make([]int, 0, len(c.listMap))
+	for freq, ll := range c.listMap {
+		if ll.Len() > 0 {
+			freqs = append(freqs, freq)
+		}
+	}
+	sort.Ints(freqs)
+	old := c.listMap
+	c.listMap = make(map[int]*list.List)
+	for _, freq := range freqs {
+		ll := old[freq]
+		for node := ll.Back(); node != nil; node = node.Prev() {
+			kv := node.Value.(*entry)
+			kv.freq = max(1, freq>>shift)
+			c.nodeMap[kv.key] = c.getList(kv.freq).PushFront(kv)
+		}
+	}
+	c.updateMinFreq()
+}
+
+// Remove 删除指定的 key, 主动删除不会触发 OnEvicted
+func (c *Cache) Remove(key string) {
+	if node, ok := c.nodeMap[key]; ok {
+		c.removeNode(node)
+	}
+}
+
+// RemoveExpired 清理所有已过期的 key
+func (c *Cache) RemoveExpired() int {
+	now := time.Now()
+	removed := 0
+	for _, node := range c.nodeMap {
+		if strategy.Expired(node.Value.(*entry).expire, now) {
+			c.evict(node)
+			removed++
+		}
+	}
+	return removed
+}
+
+func (c *Cache) removeNode(node *list.Element) *entry {
+	kv := node.Value.(*entry)
+	c.listMap[kv.freq].Remove(node)
+	delete(c.nodeMap, kv.key)
+	c.nBytes -= int64(len(kv.key)) + int64(kv.value.Len())
+	if kv.freq == c.minFreq && c.listMap[kv.freq].Len() == 0 {
+		c.updateMinFreq()
+	}
+	return kv
+}
+
+// updateMinFreq 在最小频率的链表被删空后, 重新找出当前最小的访问频率
+func (c *Cache) updateMinFreq() {
+	c.minFreq = 0
+	for freq, ll := range c.listMap {
+		if ll.Len() > 0 && (c.minFreq == 0 || freq < c.minFreq) {
+			c.minFreq = freq
+		}
+	}
+}
+
 func (c *Cache) removeOldest() {
 	ll := c.listMap[c.minFreq]
 	if ll == nil {
@@ -84,11 +231,46 @@ func (c *Cache) removeOldest() {
 	}
 	node := ll.Back()
 	if node != nil {
+		c.evict(node)
+	}
+}
+
+// evict 删除节点并触发 OnEvicted
+func (c *Cache) evict(node *list.Element) {
+	kv := c.removeNode(node)
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+func (c *Cache) Len() int {
+	return len(c.nodeMap)
+}
+
+func (c *Cache) Bytes() int64 {
+	return c.nBytes
+}
+
+// Keys 返回所有未过期的 key, 顺序不确定
+func (c *Cache) Keys() []string {
+	keys := make([]string, 0, len(c.nodeMap))
+	c.Range(func(key string, _ strategy.Value) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// Range 遍历所有未过期的 key, 顺序不确定
+func (c *Cache) Range(fn func(key string, value strategy.Value) bool) {
+	now := time.Now()
+	for _, node := range c.nodeMap {
 		kv := node.Value.(*entry)
-		c.nBytes -= int64(len(kv.key)) + int64(kv.value.Len())
-		delete(c.nodeMap, kv.key)
-		if c.OnEvicted != nil {
-			c.OnEvicted(kv.key, kv.value)
+		if strategy.Expired(kv.expire, now) {
+			continue
+		}
+		if !fn(kv.key, kv.value) {
+			return
 		}
 	}
 }
@@ -2,7 +2,11 @@ package lfu
 
 import (
 	"fmt"
+	"jie_cache/strategy"
+	"reflect"
+	"sort"
 	"testing"
+	"time"
 )
 
 type String string
@@ -26,3 +30,128 @@ func TestGet(t *testing.T) {
 		t.Fatal("nodeMap miss key3 failed")
 	}
 }
+
+func TestEvictUnlinksNode(t *testing.T) {
+	var evicted []string
+	lfu := New(int64(8), func(key string, _ strategy.Value) {
+		evicted = append(evicted, key)
+	})
+	for i := 0; i < 5; i++ {
+		lfu.Add(fmt.Sprintf("k%d", i), String("vv"))
+	}
+	// 被淘汰的节点必须从频率链表中删除，否则之后会被重复淘汰
+	if !reflect.DeepEqual(evicted, []string{"k0", "k1", "k2"}) {
+		t.Fatalf("each key should be evicted once, got %v", evicted)
+	}
+	n := 0
+	for _, ll := range lfu.listMap {
+		n += ll.Len()
+	}
+	if n != lfu.Len() || lfu.Len() != 2 {
+		t.Fatalf("frequency lists hold %d nodes, nodeMap %d", n, lfu.Len())
+	}
+}
+
+func TestRemove(t *testing.T) {
+	lfu := New(int64(0), nil)
+	lfu.Add("key1", String("1"))
+	lfu.Add("key2", String("2"))
+	lfu.Get("key2")
+	lfu.Remove("key1")
+	if _, ok := lfu.Get("key1"); ok || lfu.nBytes != 5 {
+		t.Fatal("remove key1 failed")
+	}
+	if lfu.minFreq != 2 {
+		t.Fatalf("minFreq should be 2 after removing key1, got %d", lfu.minFreq)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	lfu := New(int64(0), nil)
+	lfu.AddWithExpire("key1", String("1"), time.Now().Add(-time.Second))
+	lfu.AddWithExpire("key2", String("2"), time.Now().Add(time.Hour))
+	if _, ok := lfu.Get("key1"); ok {
+		t.Fatal("expired key1 should miss")
+	}
+	if _, ok := lfu.Get("key2"); !ok {
+		t.Fatal("key2 should not expire")
+	}
+	lfu.AddWithExpire("key3", String("3"), time.Now().Add(-time.Second))
+	if n := lfu.RemoveExpired(); n != 1 || len(lfu.nodeMap) != 1 {
+		t.Fatalf("RemoveExpired should remove key3 only, removed %d", n)
+	}
+}
+
+func TestKeysAndRange(t *testing.T) {
+	lfu := New(int64(0), nil)
+	lfu.Add("key1", String("1"))
+	lfu.Add("key2", String("22"))
+	lfu.AddWithExpire("key3", String("333"), time.Now().Add(-time.Second))
+	keys := lfu.Keys()
+	sort.Strings(keys)
+	if !reflect.DeepEqual(keys, []string{"key1", "key2"}) {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+	visited := 0
+	lfu.Range(func(string, strategy.Value) bool {
+		visited++
+		return false
+	})
+	if visited != 1 {
+		t.Fatalf("range should stop after the first key, visited %d", visited)
+	}
+	if lfu.Len() != 3 || lfu.Bytes() != 18 {
+		t.Fatalf("unexpected len %d bytes %d", lfu.Len(), lfu.Bytes())
+	}
+}
+
+func TestHalveEvery(t *testing.T) {
+	lfu := New(int64(0), nil, HalveEvery(20))
+	lfu.Add("key1", String("1"))
+	for i := 0; i < 10; i++ {
+		lfu.Get("key1")
+	}
+	lfu.Add("key2", String("2"))
+	lfu.Get("key2")
+	if f := lfu.nodeMap["key1"].Value.(*entry).freq; f != 11 {
+		t.Fatalf("key1 freq should be 11 before aging, got %d", f)
+	}
+	// 第 20 次访问触发减半
+	for i := 0; i < 7; i++ {
+		lfu.Get("missing")
+	}
+	lfu.Get("key2")
+	if f := lfu.nodeMap["key1"].Value.(*entry).freq; f != 5 {
+		t.Fatalf("key1 freq should be halved to 5, got %d", f)
+	}
+	if f := lfu.nodeMap["key2"].Value.(*entry).freq; f != 2 {
+		t.Fatalf("key2 freq should be 2 after aging and a hit, got %d", f)
+	}
+	if lfu.minFreq != 2 {
+		t.Fatalf("minFreq should be 2, got %d", lfu.minFreq)
+	}
+}
+
+func TestHalfLife(t *testing.T) {
+	now := time.Now()
+	lfu := New(int64(16), nil, HalfLife(time.Minute))
+	lfu.now = func() time.Time { return now }
+	lfu.Add("old", String("1234"))
+	for i := 0; i < 15; i++ {
+		lfu.Get("old")
+	}
+	// 过了很久以后, 以前的热点 old 应该可以被新的热点淘汰
+	now = now.Add(10 * time.Minute)
+	lfu.Add("new", String("1234"))
+	lfu.Get("new")
+	if f := lfu.nodeMap["old"].Value.(*entry).freq; f != 1 {
+		t.Fatalf("old freq should decay to 1, got %d", f)
+	}
+	lfu.Add("key3", String("1"))
+	if _, ok := lfu.nodeMap["old"]; ok {
+		t.Fatal("decayed old should be evicted")
+	}
+	if _, ok := lfu.nodeMap["new"]; !ok {
+		t.Fatal("new should stay")
+	}
+}
@@ -3,6 +3,7 @@ package lru
 import (
 	"container/list"
 	"jie_cache/strategy"
+	"time"
 )
 
 type Cache struct {
@@ -14,8 +15,15 @@ type Cache struct {
 }
 
 type entry struct {
-	key   string
-	value strategy.Value
+	key    string
+	value  strategy.Value
+	expire time.Time // 过期时间, 零值代表永不过期
+}
+
+func init() {
+	strategy.Register("LRU", func(maxBytes int64, onEvicted func(string, strategy.Value)) strategy.BaseCache {
+		return New(maxBytes, onEvicted)
+	})
 }
 
 func New(maxBytes int64, onEvicted func(string, strategy.Value)) *Cache {
@@ -29,21 +37,31 @@ func New(maxBytes int64, onEvicted func(string, strategy.Value)) *Cache {
 
 func (c *Cache) Get(key string) (value strategy.Value, ok bool) {
 	if node, ok := c.nodeMap[key]; ok {
-		c.ll.MoveToFront(node)
 		kv := node.Value.(*entry)
+		// 惰性删除过期的 key
+		if strategy.Expired(kv.expire, time.Now()) {
+			c.evict(node)
+			return nil, false
+		}
+		c.ll.MoveToFront(node)
 		return kv.value, true
 	}
 	return
 }
 
 func (c *Cache) Add(key string, value strategy.Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+func (c *Cache) AddWithExpire(key string, value strategy.Value, expire time.Time) {
 	if node, ok := c.nodeMap[key]; ok {
 		c.ll.MoveToFront(node)
 		kv := node.Value.(*entry)
 		c.nBytes += int64(value.Len()) - int64(kv.value.Len())
 		kv.value = value
+		kv.expire = expire
 	} else {
-		c.nodeMap[key] = c.ll.PushFront(&entry{key, value})
+		c.nodeMap[key] = c.ll.PushFront(&entry{key, value, expire})
 		c.nBytes += int64(len(key)) + int64(value.Len())
 	}
 
@@ -52,18 +70,78 @@ func (c *Cache) Add(key string, value strategy.Value) {
 	}
 }
 
+// Remove 删除指定的 key, 主动删除不会触发 OnEvicted
+func (c *Cache) Remove(key string) {
+	if node, ok := c.nodeMap[key]; ok {
+		c.removeNode(node)
+	}
+}
+
+// RemoveExpired 清理所有已过期的 key
+func (c *Cache) RemoveExpired() int {
+	now := time.Now()
+	removed := 0
+	for node := c.ll.Back(); node != nil; {
+		prev := node.Prev()
+		if strategy.Expired(node.Value.(*entry).expire, now) {
+			c.evict(node)
+			removed++
+		}
+		node = prev
+	}
+	return removed
+}
+
+func (c *Cache) removeNode(node *list.Element) *entry {
+	kv := c.ll.Remove(node).(*entry)
+	delete(c.nodeMap, kv.key)
+	c.nBytes -= int64(len(kv.key)) + int64(kv.value.Len())
+	return kv
+}
+
+// evict 删除节点并触发 OnEvicted
+func (c *Cache) evict(node *list.Element) {
+	kv := c.removeNode(node)
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
 func (c *Cache) removeOldest() {
 	node := c.ll.Back()
 	if node != nil {
-		kv := c.ll.Remove(node).(*entry)
-		delete(c.nodeMap, kv.key)
-		c.nBytes -= int64(len(kv.key)) + int64(kv.value.Len())
-		if c.OnEvicted != nil {
-			c.OnEvicted(kv.key, kv.value)
-		}
+		c.evict(node)
 	}
 }
 
 func (c *Cache) Len() int {
 	return c.ll.Len()
 }
+
+func (c *Cache) Bytes() int64 {
+	return c.nBytes
+}
+
+// Keys 按从新到旧的顺序返回所有未过期的 key
+func (c *Cache) Keys() []string {
+	keys := make([]string, 0, c.ll.Len())
+	c.Range(func(key string, _ strategy.Value) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// Range 按从新到旧的顺序遍历所有未过期的 key
+func (c *Cache) Range(fn func(key string, value strategy.Value) bool) {
+	now := time.Now()
+	for node := c.ll.Front(); node != nil; node = node.Next() {
+		kv := node.Value.(*entry)
+		if strategy.Expired(kv.expire, now) {
+			continue
+		}
+		if !fn(kv.key, kv.value) {
+			return
+		}
+	}
+}
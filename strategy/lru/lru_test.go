@@ -1,7 +1,10 @@
 package lru
 
 import (
+	"jie_cache/strategy"
+	"reflect"
 	"testing"
+	"time"
 )
 
 type String string
@@ -20,3 +23,49 @@ func TestGet(t *testing.T) {
 		t.Fatal("nodeMap miss key2 failed")
 	}
 }
+
+func TestRemove(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.Add("key1", String("1234"))
+	lru.Remove("key1")
+	if _, ok := lru.Get("key1"); ok || lru.Len() != 0 || lru.nBytes != 0 {
+		t.Fatal("remove key1 failed")
+	}
+}
+
+func TestExpire(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.AddWithExpire("key1", String("1234"), time.Now().Add(-time.Second))
+	lru.AddWithExpire("key2", String("1234"), time.Now().Add(time.Hour))
+	if _, ok := lru.Get("key1"); ok {
+		t.Fatal("expired key1 should miss")
+	}
+	if _, ok := lru.Get("key2"); !ok {
+		t.Fatal("key2 should not expire")
+	}
+	lru.AddWithExpire("key3", String("1234"), time.Now().Add(-time.Second))
+	if n := lru.RemoveExpired(); n != 1 || lru.Len() != 1 {
+		t.Fatalf("RemoveExpired should remove key3 only, removed %d", n)
+	}
+}
+
+func TestKeysAndRange(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.Add("key1", String("1"))
+	lru.Add("key2", String("22"))
+	lru.AddWithExpire("key3", String("333"), time.Now().Add(-time.Second))
+	if keys := lru.Keys(); !reflect.DeepEqual(keys, []string{"key2", "key1"}) {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+	var visited []string
+	lru.Range(func(key string, _ strategy.Value) bool {
+		visited = append(visited, key)
+		return false
+	})
+	if !reflect.DeepEqual(visited, []string{"key2"}) {
+		t.Fatalf("range should stop after the first key, got %v", visited)
+	}
+	if lru.Len() != 3 || lru.Bytes() != 18 {
+		t.Fatalf("unexpected len %d bytes %d", lru.Len(), lru.Bytes())
+	}
+}
@@ -0,0 +1,49 @@
+package strategy
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Factory 创建一个最大内存为 maxBytes 的淘汰策略, onEvicted 在 key 被淘汰时调用
+type Factory func(maxBytes int64, onEvicted func(key string, value Value)) BaseCache
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register 以 name 注册一个淘汰策略, 通常在策略所在包的 init 中调用。
+// name 重复或 factory 为 nil 时 panic
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if factory == nil {
+		panic("strategy: Register factory is nil")
+	}
+	if _, dup := registry[name]; dup {
+		panic(fmt.Sprintf("strategy: Register called twice for %s", name))
+	}
+	registry[name] = factory
+}
+
+// Lookup 返回以 name 注册的淘汰策略
+func Lookup(name string) (Factory, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	factory, ok := registry[name]
+	return factory, ok
+}
+
+// Names 按字典序返回所有已注册的淘汰策略的名字
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,34 @@
+package strategy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRegister(t *testing.T) {
+	factory := func(int64, func(string, Value)) BaseCache { return nil }
+	// registry 是全局的，测试结束后删除注册的策略，保证可以重复运行
+	t.Cleanup(func() {
+		registryMu.Lock()
+		defer registryMu.Unlock()
+		delete(registry, "test-a")
+		delete(registry, "test-b")
+	})
+	Register("test-b", factory)
+	Register("test-a", factory)
+	if _, ok := Lookup("test-a"); !ok {
+		t.Fatal("test-a should be registered")
+	}
+	if _, ok := Lookup("unknown"); ok {
+		t.Fatal("unknown should not be registered")
+	}
+	if names := Names(); !reflect.DeepEqual(names, []string{"test-a", "test-b"}) {
+		t.Fatalf("unexpected names %v", names)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("registering test-a twice should panic")
+		}
+	}()
+	Register("test-a", factory)
+}
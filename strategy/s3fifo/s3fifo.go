@@ -0,0 +1,254 @@
+package s3fifo
+
+import (
+	"container/list"
+	"jie_cache/strategy"
+	"sync/atomic"
+	"time"
+)
+
+// 一个 key 所在的队列
+const (
+	inSmall = iota // 新 key 先进入的小队列
+	inMain         // 在小队列中被访问过的 key
+	inGhost        // 从小队列淘汰的 key, 只保留 key 和大小
+)
+
+const (
+	smallPercent = 10 // 小队列占总内存的百分比
+	maxFreq      = 3  // 访问计数的最大值
+)
+
+// Cache 是按字节计算容量的 S3-FIFO 缓存。
+// 新 key 先进入小队列, 在小队列中没有被访问过的 key 很快被淘汰并记录到 ghost 队列,
+// 被访问过或命中 ghost 的 key 进入主队列。所有队列都是 FIFO, 命中时只增加计数, 不移动节点,
+// 所以读操作只需要读锁
+type Cache struct {
+	maxBytes  int64 // 缓存的最大内存, 0代表没有限制
+	smallMax  int64
+	bytes     [3]int64
+	queues    [3]*list.List // 头部是最新的 key, 尾部是最旧的 key
+	nodeMap   map[string]*list.Element
+	OnEvicted func(key string, value strategy.Value) // key被删除时的回调函数
+}
+
+type entry struct {
+	key    string
+	value  strategy.Value // 在 ghost 队列中为 nil
+	size   int64
+	expire time.Time // 过期时间, 零值代表永不过期
+	freq   atomic.Int32
+	where  int
+}
+
+func init() {
+	strategy.Register("S3FIFO", func(maxBytes int64, onEvicted func(string, strategy.Value)) strategy.BaseCache {
+		return New(maxBytes, onEvicted)
+	})
+}
+
+func New(maxBytes int64, onEvicted func(string, strategy.Value)) *Cache {
+	c := &Cache{
+		maxBytes:  maxBytes,
+		smallMax:  maxBytes * smallPercent / 100,
+		nodeMap:   make(map[string]*list.Element),
+		OnEvicted: onEvicted,
+	}
+	for i := range c.queues {
+		c.queues[i] = list.New()
+	}
+	return c
+}
+
+func (c *Cache) Get(key string) (strategy.Value, bool) {
+	node, ok := c.nodeMap[key]
+	if !ok {
+		return nil, false
+	}
+	kv := node.Value.(*entry)
+	if kv.where == inGhost {
+		return nil, false
+	}
+	// 惰性删除过期的 key
+	if strategy.Expired(kv.expire, time.Now()) {
+		c.evict(node)
+		return nil, false
+	}
+	kv.hit()
+	return kv.value, true
+}
+
+// ConcurrentGet 和 Get 相同, 但不删除过期的 key, 可以在读锁下并发调用
+func (c *Cache) ConcurrentGet(key string) (strategy.Value, bool) {
+	node, ok := c.nodeMap[key]
+	if !ok {
+		return nil, false
+	}
+	kv := node.Value.(*entry)
+	if kv.where == inGhost || strategy.Expired(kv.expire, time.Now()) {
+		return nil, false
+	}
+	kv.hit()
+	return kv.value, true
+}
+
+// hit 把访问计数加一, 最大为 maxFreq
+func (kv *entry) hit() {
+	for {
+		freq := kv.freq.Load()
+		if freq >= maxFreq || kv.freq.CompareAndSwap(freq, freq+1) {
+			return
+		}
+	}
+}
+
+func (c *Cache) Add(key string, value strategy.Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+func (c *Cache) AddWithExpire(key string, value strategy.Value, expire time.Time) {
+	size := int64(len(key)) + int64(value.Len())
+	if node, ok := c.nodeMap[key]; ok {
+		kv := node.Value.(*entry)
+		if kv.where == inGhost {
+			// 最近刚从小队列淘汰, 说明它会被重复访问, 直接进入主队列
+			kv.freq.Store(0)
+			c.moveTo(node, inMain)
+		} else {
+			kv.hit()
+		}
+		c.bytes[kv.where] += size - kv.size
+		kv.value, kv.size, kv.expire = value, size, expire
+	} else {
+		c.nodeMap[key] = c.queues[inSmall].PushFront(&entry{key: key, value: value, size: size, expire: expire, where: inSmall})
+		c.bytes[inSmall] += size
+	}
+
+	for c.maxBytes != 0 && c.Bytes() > c.maxBytes {
+		if c.bytes[inSmall] > c.smallMax || c.queues[inMain].Len() == 0 {
+			c.evictSmall()
+		} else {
+			c.evictMain()
+		}
+	}
+}
+
+// evictSmall 检查小队列最旧的 key, 被访问过就移到主队列, 否则淘汰并记录到 ghost 队列
+func (c *Cache) evictSmall() {
+	node := c.queues[inSmall].Back()
+	kv := node.Value.(*entry)
+	if kv.freq.Load() > 0 {
+		kv.freq.Store(0)
+		c.moveTo(node, inMain)
+		return
+	}
+	value := kv.value
+	kv.value = nil
+	c.moveTo(node, inGhost)
+	// ghost 队列记录的大小不超过主队列的内存
+	for c.bytes[inGhost] > c.maxBytes-c.smallMax && c.queues[inGhost].Len() > 0 {
+		c.removeNode(c.queues[inGhost].Back())
+	}
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, value)
+	}
+}
+
+// evictMain 检查主队列最旧的 key, 被访问过就减少计数后重新放回队列头部, 否则淘汰
+func (c *Cache) evictMain() {
+	for {
+		node := c.queues[inMain].Back()
+		kv := node.Value.(*entry)
+		if freq := kv.freq.Load(); freq > 0 {
+			kv.freq.Store(freq - 1)
+			c.queues[inMain].MoveToFront(node)
+			continue
+		}
+		c.evict(node)
+		return
+	}
+}
+
+// moveTo 把节点移动到 where 队列的头部
+func (c *Cache) moveTo(node *list.Element, where int) {
+	kv := node.Value.(*entry)
+	c.queues[kv.where].Remove(node)
+	c.bytes[kv.where] -= kv.size
+	kv.where = where
+	c.nodeMap[kv.key] = c.queues[where].PushFront(kv)
+	c.bytes[where] += kv.size
+}
+
+// Remove 删除指定的 key, 主动删除不会触发 OnEvicted
+func (c *Cache) Remove(key string) {
+	if node, ok := c.nodeMap[key]; ok {
+		c.removeNode(node)
+	}
+}
+
+// RemoveExpired 清理所有已过期的 key
+func (c *Cache) RemoveExpired() int {
+	now := time.Now()
+	removed := 0
+	for _, where := range []int{inSmall, inMain} {
+		for node := c.queues[where].Back(); node != nil; {
+			prev := node.Prev()
+			if strategy.Expired(node.Value.(*entry).expire, now) {
+				c.evict(node)
+				removed++
+			}
+			node = prev
+		}
+	}
+	return removed
+}
+
+func (c *Cache) removeNode(node *list.Element) *entry {
+	kv := node.Value.(*entry)
+	c.queues[kv.where].Remove(node)
+	c.bytes[kv.where] -= kv.size
+	delete(c.nodeMap, kv.key)
+	return kv
+}
+
+// evict 删除节点并触发 OnEvicted
+func (c *Cache) evict(node *list.Element) {
+	kv := c.removeNode(node)
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+func (c *Cache) Len() int {
+	return c.queues[inSmall].Len() + c.queues[inMain].Len()
+}
+
+func (c *Cache) Bytes() int64 {
+	return c.bytes[inSmall] + c.bytes[inMain]
+}
+
+// Keys 返回所有未过期的 key, 先主队列后小队列, 各自按从新到旧的顺序
+func (c *Cache) Keys() []string {
+	keys := make([]string, 0, c.Len())
+	c.Range(func(key string, _ strategy.Value) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// Range 遍历所有未过期的 key, 先主队列后小队列, 各自按从新到旧的顺序
+func (c *Cache) Range(fn func(key string, value strategy.Value) bool) {
+	now := time.Now()
+	for _, where := range []int{inMain, inSmall} {
+		for node := c.queues[where].Front(); node != nil; node = node.Next() {
+			kv := node.Value.(*entry)
+			if strategy.Expired(kv.expire, now) {
+				continue
+			}
+			if !fn(kv.key, kv.value) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package s3fifo
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+
+	"jie_cache/strategy"
+	"jie_cache/strategy/strategytest"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestGet(t *testing.T) {
+	s3fifo := New(int64(0), nil)
+	s3fifo.Add("key1", String("1234"))
+	if v, ok := s3fifo.Get("key1"); !ok || string(v.(String)) != "1234" {
+		t.Fatal("cache hit key1=1234 failed")
+	}
+	if _, ok := s3fifo.Get("key2"); ok {
+		t.Fatal("cache miss key2 failed")
+	}
+}
+
+func TestEvict(t *testing.T) {
+	var evicted []string
+	s3fifo := New(int64(100), func(key string, _ strategy.Value) {
+		evicted = append(evicted, key)
+	})
+	// 每个 key 占 10 字节, 被访问过的 hot 会进入主队列
+	s3fifo.Add("hot", String("1234567"))
+	s3fifo.Get("hot")
+	for i := 0; i < 20; i++ {
+		s3fifo.Add(fmt.Sprintf("once%d", i), String("12345"))
+	}
+	if _, ok := s3fifo.Get("hot"); !ok {
+		t.Fatalf("accessed hot should be moved to main queue, evicted %v", evicted)
+	}
+	if s3fifo.Bytes() > 100 {
+		t.Fatalf("bytes %d exceed maxBytes", s3fifo.Bytes())
+	}
+	if evicted[0] != "once0" {
+		t.Fatalf("once0 in small queue should be evicted first, got %v", evicted)
+	}
+
+	// 最近淘汰的 key 命中 ghost 队列, 直接进入主队列
+	last := evicted[len(evicted)-1]
+	s3fifo.Add(last, String("12345"))
+	if node := s3fifo.nodeMap[last]; node.Value.(*entry).where != inMain {
+		t.Fatal("ghost hit should insert into main queue")
+	}
+}
+
+func TestRemoveAndExpire(t *testing.T) {
+	strategytest.RemoveAndExpire(t, New(0, nil))
+}
+
+func TestConcurrentGet(t *testing.T) {
+	s3fifo := New(int64(0), nil)
+	for i := 0; i < 100; i++ {
+		s3fifo.Add(strconv.Itoa(i), String("v"))
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				if _, ok := s3fifo.ConcurrentGet(strconv.Itoa(i % 100)); !ok {
+					t.Error("concurrent get missed")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if freq := s3fifo.nodeMap["0"].Value.(*entry).freq.Load(); freq != maxFreq {
+		t.Fatalf("freq should saturate at %d, got %d", maxFreq, freq)
+	}
+}
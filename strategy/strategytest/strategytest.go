@@ -0,0 +1,77 @@
+// Package strategytest 提供淘汰策略共用的测试工具，包括命中率比较和各个策略都要满足的行为检查
+package strategytest
+
+import (
+	"fmt"
+	"jie_cache/strategy"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// String 是测试用的 strategy.Value
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+// ScanTrace 生成的访问序列：每轮把热点 key 连续访问两遍，再进行一次从不重复的扫描；
+// 中途热点整体切换，考察策略能否忘掉旧的热点。
+// 热点 key 占用 8 字节，扫描的 key 占用 10 字节
+func ScanTrace() []string {
+	var trace []string
+	scan := 0
+	for phase := 0; phase < 2; phase++ {
+		for round := 0; round < 50; round++ {
+			for pass := 0; pass < 2; pass++ {
+				for i := 0; i < 20; i++ {
+					trace = append(trace, fmt.Sprintf("hot%d-%02d", phase, i))
+				}
+			}
+			for i := 0; i < 40; i++ {
+				trace = append(trace, fmt.Sprintf("scan%05d", scan))
+				scan++
+			}
+		}
+	}
+	return trace
+}
+
+// HitRatio 按 trace 访问 c，未命中时加入 value 为 1 字节的 key，返回命中率
+func HitRatio(c strategy.BaseCache, trace []string) float64 {
+	hits := 0
+	for _, key := range trace {
+		if _, ok := c.Get(key); ok {
+			hits++
+		} else {
+			c.Add(key, String("v"))
+		}
+	}
+	return float64(hits) / float64(len(trace))
+}
+
+// RemoveAndExpire 检查 c 的过期和删除：过期的 key 不会命中，RemoveExpired 清理所有过期的 key，
+// 删除剩下的 key 后缓存为空。c 必须不限制容量
+func RemoveAndExpire(t *testing.T, c strategy.BaseCache) {
+	t.Helper()
+	expired := time.Now().Add(-time.Second)
+	c.Add("key1", String("1"))
+	c.AddWithExpire("key2", String("2"), expired)
+	if _, ok := c.Get("key2"); ok {
+		t.Fatal("expired key2 should miss")
+	}
+	if getter, ok := c.(strategy.ConcurrentGetter); ok {
+		if _, ok := getter.ConcurrentGet("key2"); ok {
+			t.Fatal("expired key2 should miss ConcurrentGet")
+		}
+	}
+	c.AddWithExpire("key3", String("3"), expired)
+	if n := c.RemoveExpired(); n == 0 || !reflect.DeepEqual(c.Keys(), []string{"key1"}) {
+		t.Fatalf("RemoveExpired should remove all expired keys, removed %d, left %v", n, c.Keys())
+	}
+	c.Remove("key1")
+	if c.Len() != 0 || c.Bytes() != 0 || len(c.Keys()) != 0 {
+		t.Fatal("remove key1 failed")
+	}
+}
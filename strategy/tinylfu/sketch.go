@@ -0,0 +1,84 @@
+package tinylfu
+
+import "jie_cache/internal/hashing"
+
+// sketch 是计数器只有 4 位(最大 15)的 count-min sketch, 用来估计 key 最近的访问频率。
+// 每记录 sampleSize 次访问就把所有计数器减半, 让过时的热点逐渐被遗忘
+type sketch struct {
+	counters   []uint8
+	mask       uint64
+	capacity   int // 能较准确估计频率的 key 的数量
+	additions  int
+	sampleSize int
+}
+
+const (
+	sketchDepth    = 4  // 每个 key 对应的计数器数量
+	maxCounter     = 15 // 计数器的最大值
+	countersPerKey = 16 // 每个 key 平均分到的计数器数量, 太少会因为冲突高估频率
+	sampleFactor   = 10 // 每记录 sampleFactor*capacity 次访问做一次衰减
+	minCapacity    = 16
+)
+
+func newSketch(capacity int) *sketch {
+	c := minCapacity
+	for c < capacity {
+		c <<= 1
+	}
+	return &sketch{
+		counters:   make([]uint8, c*countersPerKey),
+		mask:       uint64(c*countersPerKey - 1),
+		capacity:   c,
+		sampleSize: sampleFactor * c,
+	}
+}
+
+// index 用双重哈希从 h 中派生出第 i 个计数器的位置
+func (s *sketch) index(h uint64, i int) uint64 {
+	h1, h2 := h, (h>>32)|1
+	return (h1 + uint64(i)*h2) & s.mask
+}
+
+// increment 记录一次访问
+func (s *sketch) increment(h uint64) {
+	for i := 0; i < sketchDepth; i++ {
+		idx := s.index(h, i)
+		if s.counters[idx] < maxCounter {
+			s.counters[idx]++
+		}
+	}
+	s.additions++
+	if s.additions >= s.sampleSize {
+		s.reset()
+	}
+}
+
+// set 把 h 对应的计数器提高到至少 freq, 用于扩容时迁移频率
+func (s *sketch) set(h uint64, freq uint8) {
+	for i := 0; i < sketchDepth; i++ {
+		idx := s.index(h, i)
+		s.counters[idx] = max(s.counters[idx], freq)
+	}
+}
+
+// estimate 返回访问频率的估计值, 即所有计数器中的最小值
+func (s *sketch) estimate(h uint64) uint8 {
+	freq := uint8(maxCounter)
+	for i := 0; i < sketchDepth; i++ {
+		freq = min(freq, s.counters[s.index(h, i)])
+	}
+	return freq
+}
+
+// reset 把所有计数器减半
+func (s *sketch) reset() {
+	for i := range s.counters {
+		s.counters[i] >>= 1
+	}
+	s.additions /= 2
+}
+
+// hash 是混合了高位的 64 位 FNV-1a 哈希, 让双重哈希用到的高 32 位分布更均匀
+func hash(key string) uint64 {
+	return hashing.Mix(hashing.FNV1a(key))
+}
@@ -0,0 +1,269 @@
+package tinylfu
+
+import (
+	"container/list"
+	"jie_cache/strategy"
+	"time"
+)
+
+// 一个 key 所在的区域
+const (
+	inWindow    = iota // 准入窗口, 新 key 先进入这里
+	inProbation        // 主区域中只在主区域里命中过 0 次的 key
+	inProtected        // 主区域中命中过的 key
+)
+
+const (
+	windowPercent    = 1  // 准入窗口占总内存的百分比
+	protectedPercent = 80 // protected 占主区域内存的百分比
+)
+
+// Cache 是按字节计算容量的 W-TinyLFU。
+// 新 key 先进入一个很小的 LRU 窗口, 被挤出窗口后要和主区域(SLRU)中最该淘汰的 key 比较
+// sketch 估计的访问频率, 频率更高才能进入主区域, 只访问一次的 key 不会挤掉有价值的 key
+type Cache struct {
+	maxBytes     int64 // 缓存的最大内存, 0代表没有限制
+	windowMax    int64
+	protectedMax int64
+	bytes        [3]int64
+	lists        [3]*list.List
+	nodeMap      map[string]*list.Element
+	sketch       *sketch
+	OnEvicted    func(key string, value strategy.Value) // key被删除时的回调函数
+}
+
+type entry struct {
+	key    string
+	hash   uint64
+	value  strategy.Value
+	size   int64
+	expire time.Time // 过期时间, 零值代表永不过期
+	where  int
+}
+
+func init() {
+	strategy.Register("TinyLFU", func(maxBytes int64, onEvicted func(string, strategy.Value)) strategy.BaseCache {
+		return New(maxBytes, onEvicted)
+	})
+}
+
+func New(maxBytes int64, onEvicted func(string, strategy.Value)) *Cache {
+	c := &Cache{
+		maxBytes:  maxBytes,
+		windowMax: maxBytes * windowPercent / 100,
+		nodeMap:   make(map[string]*list.Element),
+		sketch:    newSketch(minCapacity),
+		OnEvicted: onEvicted,
+	}
+	c.protectedMax = (maxBytes - c.windowMax) * protectedPercent / 100
+	for i := range c.lists {
+		c.lists[i] = list.New()
+	}
+	return c
+}
+
+func (c *Cache) Get(key string) (strategy.Value, bool) {
+	h := hash(key)
+	c.sketch.increment(h)
+	node, ok := c.nodeMap[key]
+	if !ok {
+		return nil, false
+	}
+	kv := node.Value.(*entry)
+	// 惰性删除过期的 key
+	if strategy.Expired(kv.expire, time.Now()) {
+		c.evict(node)
+		return nil, false
+	}
+	c.onHit(node)
+	return kv.value, true
+}
+
+// onHit 调整命中的 key 的位置, probation 中的 key 晋升到 protected
+func (c *Cache) onHit(node *list.Element) {
+	kv := node.Value.(*entry)
+	switch kv.where {
+	case inWindow, inProtected:
+		c.lists[kv.where].MoveToFront(node)
+	case inProbation:
+		c.moveTo(node, inProtected)
+		// protected 超出预算时把最旧的 key 降级回 probation
+		for c.maxBytes != 0 && c.bytes[inProtected] > c.protectedMax && c.lists[inProtected].Len() > 1 {
+			c.moveTo(c.lists[inProtected].Back(), inProbation)
+		}
+	}
+}
+
+func (c *Cache) Add(key string, value strategy.Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+func (c *Cache) AddWithExpire(key string, value strategy.Value, expire time.Time) {
+	size := int64(len(key)) + int64(value.Len())
+	if node, ok := c.nodeMap[key]; ok {
+		kv := node.Value.(*entry)
+		c.bytes[kv.where] += size - kv.size
+		kv.value, kv.size, kv.expire = value, size, expire
+		c.onHit(node)
+	} else {
+		h := hash(key)
+		c.sketch.increment(h)
+		c.nodeMap[key] = c.lists[inWindow].PushFront(&entry{key: key, hash: h, value: value, size: size, expire: expire, where: inWindow})
+		c.bytes[inWindow] += size
+		c.ensureCapacity()
+	}
+	if c.maxBytes != 0 {
+		c.evictEntries()
+	}
+}
+
+// ensureCapacity 在 key 的数量超过 sketch 的容量时扩大 sketch,
+// 只保留缓存中已有的 key 的频率, 其他 key 的频率会被丢弃
+func (c *Cache) ensureCapacity() {
+	n := len(c.nodeMap)
+	if n <= c.sketch.capacity {
+		return
+	}
+	old := c.sketch
+	c.sketch = newSketch(2 * n)
+	for _, node := range c.nodeMap {
+		h := node.Value.(*entry).hash
+		c.sketch.set(h, old.estimate(h))
+	}
+}
+
+// evictEntries 把窗口中溢出的 key 作为候选者, 和主区域中最该淘汰的受害者比较访问频率,
+// 频率更高才能进入 probation, 否则直接淘汰候选者
+func (c *Cache) evictEntries() {
+	mainMax := c.maxBytes - c.windowMax
+	for c.bytes[inWindow] > c.windowMax {
+		candidate := c.lists[inWindow].Back()
+		cand := candidate.Value.(*entry)
+		admitted := true
+		for c.bytes[inProbation]+c.bytes[inProtected]+cand.size > mainMax {
+			victim := c.lists[inProbation].Back()
+			if victim == nil {
+				victim = c.lists[inProtected].Back()
+			}
+			if victim == nil {
+				break
+			}
+			if !c.admit(cand, victim.Value.(*entry)) {
+				admitted = false
+				break
+			}
+			c.evict(victim)
+		}
+		if admitted {
+			c.moveTo(candidate, inProbation)
+		} else {
+			c.evict(candidate)
+		}
+	}
+	// 修改已有 key 的值或单个 key 超出主区域时, 可能仍然超出 maxBytes
+	for c.Bytes() > c.maxBytes {
+		c.evictOldest()
+	}
+}
+
+// admit 判断候选者能否替换受害者, 频率相同时拒绝候选者, 保护主区域中已有的 key
+func (c *Cache) admit(candidate, victim *entry) bool {
+	return c.sketch.estimate(candidate.hash) > c.sketch.estimate(victim.hash)
+}
+
+// evictOldest 依次从 probation、protected、窗口中淘汰最旧的 key
+func (c *Cache) evictOldest() {
+	for _, where := range []int{inProbation, inProtected, inWindow} {
+		if node := c.lists[where].Back(); node != nil {
+			c.evict(node)
+			return
+		}
+	}
+}
+
+// moveTo 把节点移动到 where 链表的头部
+func (c *Cache) moveTo(node *list.Element, where int) {
+	kv := c.detach(node)
+	kv.where = where
+	c.nodeMap[kv.key] = c.lists[where].PushFront(kv)
+	c.bytes[where] += kv.size
+}
+
+func (c *Cache) detach(node *list.Element) *entry {
+	kv := node.Value.(*entry)
+	c.lists[kv.where].Remove(node)
+	c.bytes[kv.where] -= kv.size
+	return kv
+}
+
+// Remove 删除指定的 key, 主动删除不会触发 OnEvicted
+func (c *Cache) Remove(key string) {
+	if node, ok := c.nodeMap[key]; ok {
+		c.removeNode(node)
+	}
+}
+
+// RemoveExpired 清理所有已过期的 key
+func (c *Cache) RemoveExpired() int {
+	now := time.Now()
+	removed := 0
+	for _, l := range c.lists {
+		for node := l.Front(); node != nil; {
+			next := node.Next()
+			if strategy.Expired(node.Value.(*entry).expire, now) {
+				c.evict(node)
+				removed++
+			}
+			node = next
+		}
+	}
+	return removed
+}
+
+func (c *Cache) removeNode(node *list.Element) *entry {
+	kv := c.detach(node)
+	delete(c.nodeMap, kv.key)
+	return kv
+}
+
+// evict 删除节点并触发 OnEvicted
+func (c *Cache) evict(node *list.Element) {
+	kv := c.removeNode(node)
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+func (c *Cache) Len() int {
+	return len(c.nodeMap)
+}
+
+func (c *Cache) Bytes() int64 {
+	return c.bytes[inWindow] + c.bytes[inProbation] + c.bytes[inProtected]
+}
+
+// Keys 返回所有未过期的 key, 依次是 protected、probation 和窗口中的 key
+func (c *Cache) Keys() []string {
+	keys := make([]string, 0, c.Len())
+	c.Range(func(key string, _ strategy.Value) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// Range 遍历所有未过期的 key, 依次是 protected、probation 和窗口中的 key
+func (c *Cache) Range(fn func(key string, value strategy.Value) bool) {
+	now := time.Now()
+	for _, where := range []int{inProtected, inProbation, inWindow} {
+		for node := c.lists[where].Front(); node != nil; node = node.Next() {
+			kv := node.Value.(*entry)
+			if strategy.Expired(kv.expire, now) {
+				continue
+			}
+			if !fn(kv.key, kv.value) {
+				return
+			}
+		}
+	}
+}
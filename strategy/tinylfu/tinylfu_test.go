@@ -0,0 +1,105 @@
+package tinylfu
+
+import (
+	"fmt"
+	"jie_cache/strategy"
+	"jie_cache/strategy/lfu"
+	"jie_cache/strategy/lru"
+	"jie_cache/strategy/strategytest"
+	"testing"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestGet(t *testing.T) {
+	tinyLFU := New(int64(0), nil)
+	tinyLFU.Add("key1", String("1234"))
+	if v, ok := tinyLFU.Get("key1"); !ok || string(v.(String)) != "1234" {
+		t.Fatal("cache hit key1=1234 failed")
+	}
+	if _, ok := tinyLFU.Get("key2"); ok {
+		t.Fatal("cache miss key2 failed")
+	}
+}
+
+func TestAdmission(t *testing.T) {
+	var evicted []string
+	tinyLFU := New(int64(200), func(key string, _ strategy.Value) {
+		evicted = append(evicted, key)
+	})
+	// 10 个热点 key 占用一半的内存
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("hot%d", i)
+		tinyLFU.Add(key, String("123456"))
+		for j := 0; j < 3; j++ {
+			tinyLFU.Get(key)
+		}
+	}
+	if len(evicted) != 0 {
+		t.Fatalf("nothing should be evicted yet, got %v", evicted)
+	}
+	// 只访问一次的 key 不能挤掉热点 key
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("one%d", i)
+		tinyLFU.Get(key)
+		tinyLFU.Add(key, String("123456"))
+	}
+	for i := 0; i < 10; i++ {
+		if _, ok := tinyLFU.Get(fmt.Sprintf("hot%d", i)); !ok {
+			t.Fatalf("hot%d should not be evicted by one-hit wonders", i)
+		}
+	}
+	if tinyLFU.Bytes() > 200 {
+		t.Fatalf("bytes %d exceed maxBytes", tinyLFU.Bytes())
+	}
+
+	// 访问足够多次的新 key 可以进入主区域
+	for j := 0; j < 5; j++ {
+		tinyLFU.Get("newhot")
+	}
+	tinyLFU.Add("newhot", String("12345"))
+	if _, ok := tinyLFU.Get("newhot"); !ok {
+		t.Fatal("frequently requested newhot should be admitted")
+	}
+}
+
+func TestRemoveAndExpire(t *testing.T) {
+	strategytest.RemoveAndExpire(t, New(0, nil))
+}
+
+func TestSketchAging(t *testing.T) {
+	s := newSketch(minCapacity)
+	h := hash("key")
+	for i := 0; i < 20; i++ {
+		s.increment(h)
+	}
+	if f := s.estimate(h); f != maxCounter {
+		t.Fatalf("counter should saturate at %d, got %d", maxCounter, f)
+	}
+	// 不断记录其他 key 的访问直到触发衰减
+	for i := 0; s.estimate(h) == maxCounter; i++ {
+		s.increment(hash(fmt.Sprint(i)))
+	}
+	if f := s.estimate(h); f > maxCounter/2+1 {
+		t.Fatalf("counter should be halved after reset, got %d", f)
+	}
+}
+
+func TestHitRatioOnScans(t *testing.T) {
+	trace := strategytest.ScanTrace()
+	const maxBytes = 300
+	tinyLFURatio := strategytest.HitRatio(New(maxBytes, nil), trace)
+	lruRatio := strategytest.HitRatio(lru.New(maxBytes, nil), trace)
+	lfuRatio := strategytest.HitRatio(lfu.New(maxBytes, nil), trace)
+	t.Logf("hit ratio tinylfu %.3f lru %.3f lfu %.3f", tinyLFURatio, lruRatio, lfuRatio)
+	if tinyLFURatio <= lruRatio {
+		t.Fatalf("tinylfu should beat lru on scans, tinylfu %.3f lru %.3f", tinyLFURatio, lruRatio)
+	}
+	if tinyLFURatio <= lfuRatio {
+		t.Fatalf("tinylfu should beat lfu after the hot set changes, tinylfu %.3f lfu %.3f", tinyLFURatio, lfuRatio)
+	}
+}
@@ -0,0 +1,250 @@
+// Package trace 把 Group 的访问记录到按大小轮转的 CSV 文件中，用于回放模拟和容量规划。
+//
+// 每行是一次访问：纳秒时间戳,key 的 64 位 FNV-1a 哈希(16 进制),value 大小,结果，例如
+//
+//	1700000000123456789,9f86d081884c7d65,128,local
+//
+// 可以直接交给 jiecache-sim 回放，加载失败和不存在的 key 的访问会被跳过：
+//
+//	jiecache-sim -keycol 1 -sizecol 2 -outcomecol 3 trace.csv trace.csv.1
+package trace
+
+import (
+	"bufio"
+	"fmt"
+	"jie_cache/internal/hashing"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Outcome 是一次访问的结果
+type Outcome string
+
+const (
+	Hot      Outcome = "hot"      // 命中 hotCache
+	Main     Outcome = "main"     // 命中 mainCache
+	Peer     Outcome = "peer"     // 从远程节点加载
+	Local    Outcome = "local"    // 从本地数据源加载
+	Error    Outcome = "error"    // 加载失败
+	Negative Outcome = "negative" // 命中不存在的 key 的缓存
+	Rejected Outcome = "rejected" // 被 Bloom filter 判断为不存在
+)
+
+const (
+	DEFAULT_MAX_FILE_BYTES = 64 << 20 // 单个文件的最大字节数
+	DEFAULT_MAX_FILES      = 3        // 保留的轮转文件数量，不包括正在写入的文件
+	bufferSize             = 64 << 10
+	flushInterval          = time.Second
+)
+
+// Recorder 把采样后的访问追加到文件中，并发安全。
+// 采样按 key 的哈希进行，同一个 key 的访问要么全部记录要么全部不记录，回放时的命中率更准确
+type Recorder struct {
+	path         string
+	sampleRate   float64
+	threshold    uint64 // 哈希小于 threshold 的 key 被采样
+	maxFileBytes int64
+	maxFiles     int
+
+	mu        sync.Mutex
+	f         *os.File
+	w         *bufio.Writer
+	written   int64 // 当前文件已经写入的字节数
+	lastFlush time.Time
+	buf       []byte
+	err       error // 第一次写入错误，之后不再记录
+
+	recorded atomic.Int64
+}
+
+// Option 配置 Recorder
+type Option func(r *Recorder)
+
+// SampleRate 设置采样比例，取值 (0, 1]，默认全部记录
+func SampleRate(rate float64) Option {
+	return func(r *Recorder) {
+		if rate <= 0 || rate > 1 {
+			panic("sample rate must be in (0, 1]")
+		}
+		r.sampleRate = rate
+	}
+}
+
+// MaxFileBytes 设置单个文件的最大字节数，超过后轮转
+func MaxFileBytes(n int64) Option {
+	return func(r *Recorder) {
+		if n <= 0 {
+			panic("max file bytes must be positive")
+		}
+		r.maxFileBytes = n
+	}
+}
+
+// MaxFiles 设置保留的轮转文件数量，轮转后的文件名为 path.1、path.2 ...，数字越大越旧
+func MaxFiles(n int) Option {
+	return func(r *Recorder) {
+		if n < 0 {
+			panic("max files must not be negative")
+		}
+		r.maxFiles = n
+	}
+}
+
+// NewRecorder 创建一个追加写入 path 的 Recorder
+func NewRecorder(path string, opts ...Option) (*Recorder, error) {
+	r := &Recorder{
+		path:         path,
+		sampleRate:   1,
+		maxFileBytes: DEFAULT_MAX_FILE_BYTES,
+		maxFiles:     DEFAULT_MAX_FILES,
+		lastFlush:    time.Now(),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	r.threshold = math.MaxUint64
+	if r.sampleRate < 1 {
+		r.threshold = uint64(r.sampleRate * math.MaxUint64)
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Recorder) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f = f
+	r.w = bufio.NewWriterSize(f, bufferSize)
+	r.written = info.Size()
+	return nil
+}
+
+// Record 记录一次访问，没有被采样的 key 直接返回
+func (r *Recorder) Record(key string, size int, outcome Outcome) {
+	h := hashing.FNV1a(key)
+	if h > r.threshold {
+		return
+	}
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil || r.w == nil {
+		return
+	}
+	b := r.buf[:0]
+	b = strconv.AppendInt(b, now.UnixNano(), 10)
+	b = append(b, ',')
+	b = appendHex(b, h)
+	b = append(b, ',')
+	b = strconv.AppendInt(b, int64(size), 10)
+	b = append(b, ',')
+	b = append(b, outcome...)
+	b = append(b, '\n')
+	r.buf = b
+
+	if r.written > 0 && r.written+int64(len(b)) > r.maxFileBytes {
+		if r.err = r.rotate(); r.err != nil {
+			return
+		}
+	}
+	if _, r.err = r.w.Write(b); r.err != nil {
+		return
+	}
+	r.written += int64(len(b))
+	r.recorded.Add(1)
+	if now.Sub(r.lastFlush) >= flushInterval {
+		r.lastFlush = now
+		r.err = r.w.Flush()
+	}
+}
+
+// rotate 关闭当前文件，把 path.n 重命名为 path.n+1，path 重命名为 path.1，再重新打开 path
+func (r *Recorder) rotate() error {
+	if err := r.w.Flush(); err != nil {
+		return err
+	}
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	if r.maxFiles == 0 {
+		if err := os.Remove(r.path); err != nil {
+			return err
+		}
+		return r.open()
+	}
+	os.Remove(r.rotated(r.maxFiles))
+	for i := r.maxFiles - 1; i >= 1; i-- {
+		if err := os.Rename(r.rotated(i), r.rotated(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(r.path, r.rotated(1)); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+func (r *Recorder) rotated(i int) string {
+	return fmt.Sprintf("%s.%d", r.path, i)
+}
+
+// Recorded 返回已经记录的访问数量
+func (r *Recorder) Recorded() int64 {
+	return r.recorded.Load()
+}
+
+// Path 返回正在写入的文件
+func (r *Recorder) Path() string {
+	return r.path
+}
+
+// Flush 把缓冲区中的记录写入文件
+func (r *Recorder) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil || r.w == nil {
+		return r.err
+	}
+	r.err = r.w.Flush()
+	return r.err
+}
+
+// Close 写入缓冲区中的记录并关闭文件，之后的 Record 不再记录
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.w == nil {
+		return r.err
+	}
+	err := r.w.Flush()
+	if closeErr := r.f.Close(); err == nil {
+		err = closeErr
+	}
+	r.f, r.w = nil, nil
+	if r.err != nil {
+		return r.err
+	}
+	return err
+}
+
+// appendHex 以固定 16 位的 16 进制追加 h
+func appendHex(b []byte, h uint64) []byte {
+	const digits = "0123456789abcdef"
+	for shift := 60; shift >= 0; shift -= 4 {
+		b = append(b, digits[(h>>uint(shift))&0xf])
+	}
+	return b
+}
@@ -0,0 +1,82 @@
+package trace
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.csv")
+	r, err := NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Record("Tom", 3, Local)
+	r.Record("Tom", 3, Main)
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r.Record("Tom", 3, Main) // 关闭后不再记录
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || r.Recorded() != 2 {
+		t.Fatalf("expect 2 records, got %q", lines)
+	}
+	fields := strings.Split(lines[0], ",")
+	if len(fields) != 4 || len(fields[1]) != 16 || fields[2] != "3" || fields[3] != "local" {
+		t.Fatalf("unexpected record %q", lines[0])
+	}
+	if _, err := strconv.ParseInt(fields[0], 10, 64); err != nil {
+		t.Fatalf("invalid timestamp %q", fields[0])
+	}
+	if strings.Split(lines[1], ",")[1] != fields[1] {
+		t.Fatal("the same key should have the same hash")
+	}
+}
+
+func TestRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.csv")
+	r, err := NewRecorder(path, MaxFileBytes(100), MaxFiles(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		r.Record(strconv.Itoa(i), 10, Peer)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() > 100 {
+			t.Fatalf("%s has %d bytes, exceeds max file bytes", name, info.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatal("only 2 rotated files should be kept")
+	}
+}
+
+func TestSampleRate(t *testing.T) {
+	r, err := NewRecorder(filepath.Join(t.TempDir(), "trace.csv"), SampleRate(0.1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for i := 0; i < 10000; i++ {
+		r.Record(strconv.Itoa(i), 1, Main)
+	}
+	if n := r.Recorded(); n < 700 || n > 1300 {
+		t.Fatalf("about 10%% of keys should be sampled, got %d", n)
+	}
+}